@@ -2,15 +2,18 @@ package main
 
 import (
 	"crypto/sha256"
+	"errors"
 	"fmt"
 	"io"
 	"log"
 	"net/http"
+	"net/url"
 	"os"
 	"os/signal"
 	"strconv"
 	"strings"
 	"syscall"
+	"time"
 
 	"github.com/P-H-Pancholi/httpfromtcp/internal/headers"
 	"github.com/P-H-Pancholi/httpfromtcp/internal/request"
@@ -35,19 +38,19 @@ func main() {
 }
 
 func handler(w *response.Writer, req *request.Request) {
-	if strings.HasPrefix(req.RequestLine.RequestTarget, "/httpbin") {
+	if strings.HasPrefix(req.Path(), "/httpbin") {
 		proxyHandler(w, req)
 		return
 	}
-	if req.RequestLine.RequestTarget == "/yourproblem" {
+	if req.Path() == "/yourproblem" {
 		handler200(w, req)
 		return
 	}
-	if req.RequestLine.RequestTarget == "/myproblem" {
+	if req.Path() == "/myproblem" {
 		handler500(w, req)
 		return
 	}
-	if req.RequestLine.RequestTarget == "/video" {
+	if req.Path() == "/video" {
 		videoHandler(w, req)
 		return
 	}
@@ -90,8 +93,7 @@ func handler500(w *response.Writer, _ *request.Request) {
 	w.WriteBody(body)
 }
 
-func handler200(w *response.Writer, _ *request.Request) {
-	w.WriteStatusLine(200)
+func handler200(w *response.Writer, req *request.Request) {
 	body := []byte(`<html>
 <head>
 <title>200 OK</title>
@@ -102,17 +104,46 @@ func handler200(w *response.Writer, _ *request.Request) {
 </body>
 </html>
 `)
-	h := response.GetDefaultHeaders(len(body))
-	h.Override("Content-Type", "text/html")
+	h := response.GetDefaultHeaders(0)
+	offer, ok := server.Negotiate(w, req, h,
+		server.Offer{ContentType: "text/html"},
+		server.Offer{ContentType: "text/plain"},
+	)
+	if !ok {
+		return
+	}
+	if offer.ContentType == "text/plain" {
+		body = []byte("Success! Your request was an absolute banger.\n")
+	}
+	h.Override("Content-Length", strconv.Itoa(len(body)))
+	// the page never changes, reloads can use the cached copy
+	etag := fmt.Sprintf(`"%x"`, sha256.Sum256(body))
+	h.Override("ETag", etag)
+	if server.CheckPreconditions(w, req, h, etag, time.Time{}) {
+		return
+	}
+	w.WriteStatusLine(200)
 	w.WriteHeaders(h)
 	w.WriteBody(body)
 }
 
 func proxyHandler(w *response.Writer, req *request.Request) {
-	target := strings.TrimPrefix(req.RequestLine.RequestTarget, "/httpbin/")
-	url := "https://httpbin.org/" + target
-	fmt.Println("Proxying to", url)
-	resp, err := http.Get(url)
+	// forward the normalised path the request was routed by, the raw one
+	// may still hold dot segments that lead elsewhere
+	path := strings.TrimPrefix(strings.TrimPrefix(req.Path(), "/httpbin"), "/")
+	upstream := url.URL{
+		Scheme:   "https",
+		Host:     "httpbin.org",
+		Path:     "/" + path,
+		RawQuery: req.RawQuery(),
+	}
+	fmt.Println("Proxying to", upstream.String())
+	proxyReq, err := http.NewRequestWithContext(req.Context(), http.MethodGet, upstream.String(), nil)
+	if err != nil {
+		handler500(w, req)
+		return
+	}
+	resp, err := http.DefaultClient.Do(proxyReq)
 	if err != nil {
 		handler500(w, req)
 		return
@@ -159,16 +190,49 @@ func proxyHandler(w *response.Writer, req *request.Request) {
 }
 
 func videoHandler(w *response.Writer, req *request.Request) {
-	data, err := os.ReadFile("assets/vim.mp4")
+	f, err := os.Open("assets/vim.mp4")
 	if err != nil {
 		fmt.Println("Error reading file:", err)
+		handler500(w, req)
+		return
 	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		fmt.Println("Error reading file:", err)
+		handler500(w, req)
+		return
+	}
+	size := info.Size()
+	etag := fmt.Sprintf(`"%x-%x"`, info.ModTime().UnixNano(), size)
 
-	w.WriteStatusLine(200)
-	h := response.GetDefaultHeaders(len(data))
+	h := response.GetDefaultHeaders(int(size))
 	h.Override("Content-Type", "video/mp4")
-	w.WriteHeaders(h)
+	h.Override("Accept-Ranges", "bytes")
+	h.Override("Last-Modified", headers.FormatTime(info.ModTime()))
+	h.Override("ETag", etag)
+	if server.CheckPreconditions(w, req, h, etag, info.ModTime()) {
+		return
+	}
 
-	w.WriteBody(data)
+	// seeking in the player asks for the rest of the video from a range
+	ranges, err := req.Ranges(size, etag, info.ModTime())
+	if errors.Is(err, headers.ErrRangeNotSatisfiable) {
+		w.WriteRangeNotSatisfiable(size)
+		return
+	}
+	if len(ranges) > 0 {
+		w.WritePartialContent(h, f, size, ranges)
+		return
+	}
 
+	data, err := io.ReadAll(f)
+	if err != nil {
+		fmt.Println("Error reading file:", err)
+		handler500(w, req)
+		return
+	}
+	w.WriteStatusLine(200)
+	w.WriteHeaders(h)
+	w.WriteBody(data)
 }
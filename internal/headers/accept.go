@@ -0,0 +1,181 @@
+package headers
+
+import (
+	"strconv"
+	"strings"
+)
+
+// AcceptRange is one member of an Accept, Accept-Encoding or
+// Accept-Language list
+type AcceptRange struct {
+	// Value is the lower-cased media range, content-coding or language
+	// range, "text/*", "gzip" or "en-us"
+	Value string
+	// Params holds the media range parameters before the weight, only set
+	// for Accept
+	Params map[string]string
+	// Q is the weight between 0 and 1, 0 means not acceptable
+	Q float64
+}
+
+// ParseAccept parses the media ranges of an Accept value such as
+// `text/html, application/*;q=0.8`. Members that don't parse are skipped.
+func ParseAccept(v string) []AcceptRange {
+	var ranges []AcceptRange
+	for _, member := range strings.Split(v, ",") {
+		member, weight := cutWeight(member)
+		mediaType, params, err := ParseMediaType(member)
+		if err != nil {
+			continue
+		}
+		// "*/html" isn't a media range
+		if typ, subtype, _ := strings.Cut(mediaType, "/"); typ == "*" && subtype != "*" {
+			continue
+		}
+		q, ok := parseQValue(weight)
+		if !ok {
+			continue
+		}
+		ranges = append(ranges, AcceptRange{Value: mediaType, Params: params, Q: q})
+	}
+	return ranges
+}
+
+// ParseAcceptList parses an Accept-Encoding or Accept-Language value such
+// as `gzip;q=1.0, identity; q=0.5, *;q=0`. Members that don't parse are
+// skipped.
+func ParseAcceptList(v string) []AcceptRange {
+	var ranges []AcceptRange
+	for _, member := range strings.Split(v, ",") {
+		member, weight := cutWeight(member)
+		member = strings.ToLower(strings.TrimSpace(member))
+		if !isToken(member) {
+			continue
+		}
+		q, ok := parseQValue(weight)
+		if !ok {
+			continue
+		}
+		ranges = append(ranges, AcceptRange{Value: member, Q: q})
+	}
+	return ranges
+}
+
+// cutWeight splits a member at its ";q=" weight parameter. Extension
+// parameters after the weight are dropped.
+func cutWeight(member string) (rest, weight string) {
+	params := strings.Split(member, ";")
+	for i, p := range params[1:] {
+		name, value, ok := strings.Cut(p, "=")
+		if ok && strings.EqualFold(strings.TrimSpace(name), "q") {
+			return strings.Join(params[:i+1], ";"), strings.TrimSpace(value)
+		}
+	}
+	return member, ""
+}
+
+// parseQValue parses a weight, RFC 9110 section 12.4.2. An empty weight
+// is 1.
+func parseQValue(s string) (float64, bool) {
+	if s == "" {
+		return 1, true
+	}
+	if len(s) > 5 || (s[0] != '0' && s[0] != '1') || (len(s) > 1 && s[1] != '.') {
+		return 0, false
+	}
+	for i := 2; i < len(s); i++ {
+		if s[i] < '0' || s[i] > '9' || (s[0] == '1' && s[i] != '0') {
+			return 0, false
+		}
+	}
+	q, err := strconv.ParseFloat(strings.TrimSuffix(s, "."), 64)
+	return q, err == nil
+}
+
+// MediaTypeQuality returns the weight ranges give to the media type, the
+// weight of the most specific range that matches it. A range with
+// parameters only matches a media type that has all of them.
+func MediaTypeQuality(ranges []AcceptRange, mediaType string) float64 {
+	mediaType, params, err := ParseMediaType(mediaType)
+	if err != nil {
+		return 0
+	}
+	typ, _, _ := strings.Cut(mediaType, "/")
+	q, best := 0.0, -1
+	for _, r := range ranges {
+		var specificity int
+		switch {
+		case r.Value == mediaType:
+			specificity = 2 + len(r.Params)
+		case r.Value == typ+"/*":
+			specificity = 1
+		case r.Value == "*/*":
+			specificity = 0
+		default:
+			continue
+		}
+		if !hasParams(params, r.Params) || specificity <= best {
+			continue
+		}
+		q, best = r.Q, specificity
+	}
+	return q
+}
+
+func hasParams(params, want map[string]string) bool {
+	for name, value := range want {
+		// charset values are case-insensitive, RFC 9110 section 8.3.2
+		if v, ok := params[name]; !ok || v != value && !(name == "charset" && strings.EqualFold(v, value)) {
+			return false
+		}
+	}
+	return true
+}
+
+// EncodingQuality returns the weight ranges from Accept-Encoding give to
+// the content-coding. identity is acceptable unless it is excluded with a
+// weight of 0, directly or through "*".
+func EncodingQuality(ranges []AcceptRange, coding string) float64 {
+	coding = strings.ToLower(coding)
+	q, found, anyQ, anyFound := 0.0, false, 0.0, false
+	for _, r := range ranges {
+		switch r.Value {
+		case coding:
+			q, found = r.Q, true
+		case "*":
+			anyQ, anyFound = r.Q, true
+		}
+	}
+	switch {
+	case found:
+		return q
+	case anyFound:
+		return anyQ
+	case coding == "identity":
+		return 1
+	}
+	return 0
+}
+
+// LanguageQuality returns the weight ranges from Accept-Language give to
+// the language tag. Ranges match with the basic filtering of RFC 4647
+// section 3.3.1, "en" matches "en-GB", and the longest match wins.
+func LanguageQuality(ranges []AcceptRange, tag string) float64 {
+	tag = strings.ToLower(tag)
+	q, best := 0.0, -1
+	for _, r := range ranges {
+		var length int
+		switch {
+		case r.Value == "*":
+			length = 0
+		case r.Value == tag || strings.HasPrefix(tag, r.Value+"-"):
+			length = len(r.Value)
+		default:
+			continue
+		}
+		if length > best {
+			q, best = r.Q, length
+		}
+	}
+	return q
+}
@@ -0,0 +1,146 @@
+package headers
+
+import (
+	"errors"
+	"maps"
+	"slices"
+	"strings"
+)
+
+var ErrInvalidCredentials = errors.New("invalid credentials")
+
+// Credentials are the value of an Authorization header, RFC 9110 section
+// 11.4. A scheme carries either a Token68 or a list of Params.
+type Credentials struct {
+	// Scheme is lower-cased, "basic" or "bearer"
+	Scheme  string
+	Token68 string
+	// Params has lower-cased names and unquoted values
+	Params map[string]string
+}
+
+// ParseCredentials parses an Authorization or Proxy-Authorization value
+// such as "Basic QWxhZGRpbjpvcGVuIHNlc2FtZQ==" or
+// `Digest username="Mufasa", realm="testrealm"`
+func ParseCredentials(v string) (*Credentials, error) {
+	scheme, rest, _ := strings.Cut(strings.TrimSpace(v), " ")
+	if !isToken(scheme) {
+		return nil, ErrInvalidCredentials
+	}
+	c := &Credentials{Scheme: strings.ToLower(scheme)}
+	rest = strings.TrimLeft(rest, " ")
+	if rest == "" {
+		return c, nil
+	}
+	if isToken68(rest) {
+		c.Token68 = rest
+		return c, nil
+	}
+	params, err := parseAuthParams(rest)
+	if err != nil {
+		return nil, ErrInvalidCredentials
+	}
+	c.Params = params
+	return c, nil
+}
+
+// isToken68 reports whether s is a token68, characters of the base64 or
+// base64url alphabets followed by optional '=' padding
+func isToken68(s string) bool {
+	padded := strings.TrimRight(s, "=")
+	if padded == "" {
+		return false
+	}
+	for i := 0; i < len(padded); i++ {
+		c := padded[i]
+		switch {
+		case c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9':
+		case c == '-' || c == '.' || c == '_' || c == '~' || c == '+' || c == '/':
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// parseAuthParams parses a comma separated list of name=value pairs where
+// a value is a token or quoted-string. Empty list elements are allowed.
+func parseAuthParams(s string) (map[string]string, error) {
+	params := map[string]string{}
+	for {
+		s = strings.TrimLeft(s, " \t")
+		if s == "" {
+			return params, nil
+		}
+		if s[0] == ',' {
+			s = s[1:]
+			continue
+		}
+		name, value, ok := strings.Cut(s, "=")
+		name = strings.ToLower(strings.TrimSpace(name))
+		if !ok || !isToken(name) {
+			return nil, ErrInvalidCredentials
+		}
+		if _, dup := params[name]; dup {
+			// RFC 9110 section 11.2 allows each name once per scheme
+			return nil, ErrInvalidCredentials
+		}
+		value, s, ok = consumeValue(strings.TrimLeft(value, " \t"))
+		if !ok {
+			return nil, ErrInvalidCredentials
+		}
+		params[name] = value
+		s = strings.TrimLeft(s, " \t")
+		if s != "" && s[0] != ',' {
+			return nil, ErrInvalidCredentials
+		}
+	}
+}
+
+// Challenge is one challenge of a WWW-Authenticate header
+type Challenge struct {
+	Scheme  string
+	Token68 string
+	// Params are sent as quoted-strings, realm first and the others
+	// sorted by name
+	Params map[string]string
+}
+
+// String formats the challenge, `Basic realm="internal", charset="UTF-8"`
+func (c Challenge) String() string {
+	var b strings.Builder
+	b.WriteString(c.Scheme)
+	if c.Token68 != "" {
+		b.WriteString(" " + c.Token68)
+		return b.String()
+	}
+	names := slices.Sorted(maps.Keys(c.Params))
+	if i := slices.Index(names, "realm"); i > 0 {
+		names = slices.Insert(slices.Delete(names, i, i+1), 0, "realm")
+	}
+	for i, name := range names {
+		if i == 0 {
+			b.WriteString(" ")
+		} else {
+			b.WriteString(", ")
+		}
+		b.WriteString(name + "=" + quoteString(c.Params[name]))
+	}
+	return b.String()
+}
+
+// quoteString returns s as a quoted-string, escaping quotes and
+// backslashes
+func quoteString(s string) string {
+	var b strings.Builder
+	b.Grow(len(s) + 2)
+	b.WriteByte('"')
+	for i := 0; i < len(s); i++ {
+		if s[i] == '"' || s[i] == '\\' {
+			b.WriteByte('\\')
+		}
+		b.WriteByte(s[i])
+	}
+	b.WriteByte('"')
+	return b.String()
+}
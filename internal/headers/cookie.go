@@ -0,0 +1,145 @@
+package headers
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var ErrInvalidCookie = errors.New("invalid cookie")
+
+// SameSite is the SameSite attribute of a cookie
+type SameSite int
+
+const (
+	// SameSiteDefault leaves the attribute out
+	SameSiteDefault SameSite = iota
+	SameSiteLax
+	SameSiteStrict
+	SameSiteNone
+)
+
+// Cookie is an HTTP cookie as described in RFC 6265. Requests only carry
+// the name and value, the other fields are attributes sent in Set-Cookie.
+type Cookie struct {
+	Name  string
+	Value string
+
+	Path    string
+	Domain  string
+	Expires time.Time
+	// MaxAge is left out when zero, a negative MaxAge deletes the cookie
+	// and is sent as Max-Age=0
+	MaxAge      int
+	Secure      bool
+	HttpOnly    bool
+	SameSite    SameSite
+	Partitioned bool
+}
+
+// Valid reports whether the cookie can be sent in a Set-Cookie header
+func (c *Cookie) Valid() error {
+	if !isToken(c.Name) {
+		return fmt.Errorf("%w: name %q", ErrInvalidCookie, c.Name)
+	}
+	for i := 0; i < len(c.Value); i++ {
+		if !isCookieValueChar(c.Value[i]) && c.Value[i] != ' ' && c.Value[i] != ',' {
+			return fmt.Errorf("%w: value %q", ErrInvalidCookie, c.Value)
+		}
+	}
+	for _, attr := range []string{c.Path, c.Domain} {
+		for i := 0; i < len(attr); i++ {
+			if attr[i] < ' ' || attr[i] == 0x7f || attr[i] == ';' {
+				return fmt.Errorf("%w: attribute %q", ErrInvalidCookie, attr)
+			}
+		}
+	}
+	if c.Partitioned && !c.Secure {
+		return fmt.Errorf("%w: partitioned cookies must be secure", ErrInvalidCookie)
+	}
+	return nil
+}
+
+// String returns the cookie serialised for a Set-Cookie header. A value
+// holding a space or comma is quoted.
+func (c *Cookie) String() string {
+	var b strings.Builder
+	b.WriteString(c.Name)
+	b.WriteByte('=')
+	if strings.ContainsAny(c.Value, " ,") {
+		b.WriteString(`"` + c.Value + `"`)
+	} else {
+		b.WriteString(c.Value)
+	}
+	if c.Path != "" {
+		b.WriteString("; Path=" + c.Path)
+	}
+	if c.Domain != "" {
+		b.WriteString("; Domain=" + strings.TrimPrefix(c.Domain, "."))
+	}
+	if !c.Expires.IsZero() {
+		b.WriteString("; Expires=" + FormatTime(c.Expires))
+	}
+	if c.MaxAge > 0 {
+		b.WriteString("; Max-Age=" + strconv.Itoa(c.MaxAge))
+	} else if c.MaxAge < 0 {
+		b.WriteString("; Max-Age=0")
+	}
+	if c.Secure {
+		b.WriteString("; Secure")
+	}
+	if c.HttpOnly {
+		b.WriteString("; HttpOnly")
+	}
+	switch c.SameSite {
+	case SameSiteLax:
+		b.WriteString("; SameSite=Lax")
+	case SameSiteStrict:
+		b.WriteString("; SameSite=Strict")
+	case SameSiteNone:
+		b.WriteString("; SameSite=None")
+	}
+	if c.Partitioned {
+		b.WriteString("; Partitioned")
+	}
+	return b.String()
+}
+
+// ParseCookie parses the value of a Cookie request header, such as
+// "session=abc; theme=dark". Malformed pairs are skipped.
+func ParseCookie(v string) []*Cookie {
+	var cookies []*Cookie
+	for _, pair := range strings.Split(v, ";") {
+		name, value, ok := strings.Cut(strings.TrimSpace(pair), "=")
+		if !ok || !isToken(name) {
+			continue
+		}
+		quoted := len(value) > 1 && value[0] == '"' && value[len(value)-1] == '"'
+		if quoted {
+			value = value[1 : len(value)-1]
+		}
+		valid := true
+		for i := 0; i < len(value); i++ {
+			if !isCookieValueChar(value[i]) && !(quoted && (value[i] == ' ' || value[i] == ',')) {
+				valid = false
+				break
+			}
+		}
+		if !valid {
+			continue
+		}
+		cookies = append(cookies, &Cookie{Name: name, Value: value})
+	}
+	return cookies
+}
+
+// isCookieValueChar reports whether c is a cookie-octet of RFC 6265
+func isCookieValueChar(c byte) bool {
+	return c == 0x21 ||
+		c >= 0x23 && c <= 0x2b ||
+		c >= 0x2d && c <= 0x3a ||
+		c >= 0x3c && c <= 0x5b ||
+		c >= 0x5d && c <= 0x7e
+}
@@ -0,0 +1,34 @@
+package headers
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+// TimeFormat is the IMF-fixdate format of HTTP-date, RFC 9110 section 5.6.7
+const TimeFormat = "Mon, 02 Jan 2006 15:04:05 GMT"
+
+// FormatTime formats t as an HTTP-date, which is always in GMT
+func FormatTime(t time.Time) string {
+	return t.UTC().Format(TimeFormat)
+}
+
+// the obsolete HTTP-date formats recipients still have to accept
+const (
+	rfc850Format  = "Monday, 02-Jan-06 15:04:05 GMT"
+	asctimeFormat = "Mon Jan _2 15:04:05 2006"
+)
+
+var ErrInvalidDate = errors.New("invalid http-date")
+
+// ParseTime parses an HTTP-date in the IMF-fixdate format or one of the
+// obsolete RFC 850 and asctime formats
+func ParseTime(s string) (time.Time, error) {
+	for _, layout := range []string{TimeFormat, rfc850Format, asctimeFormat} {
+		if t, err := time.Parse(layout, s); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("%w: %q", ErrInvalidDate, s)
+}
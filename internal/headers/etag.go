@@ -0,0 +1,47 @@
+package headers
+
+import "strings"
+
+// ValidETag reports whether s is an entity-tag as in RFC 9110 section
+// 8.8.3, a quoted opaque-tag with an optional W/ prefix for weak tags
+func ValidETag(s string) bool {
+	s = strings.TrimPrefix(s, "W/")
+	if len(s) < 2 || s[0] != '"' || s[len(s)-1] != '"' {
+		return false
+	}
+	for i := 1; i < len(s)-1; i++ {
+		// etagc = %x21 / %x23-7E / obs-text
+		if c := s[i]; c == '"' || c < 0x21 || c == 0x7f {
+			return false
+		}
+	}
+	return true
+}
+
+// ETagStrongMatch compares two entity-tags with the strong comparison of
+// RFC 9110 section 8.8.3.2, both have to be strong and identical
+func ETagStrongMatch(a, b string) bool {
+	return ValidETag(a) && !strings.HasPrefix(a, "W/") && a == b
+}
+
+// ETagWeakMatch compares two entity-tags with the weak comparison, their
+// opaque-tags have to be identical whether they are weak or not
+func ETagWeakMatch(a, b string) bool {
+	return ValidETag(a) && ValidETag(b) && strings.TrimPrefix(a, "W/") == strings.TrimPrefix(b, "W/")
+}
+
+// ParseETags splits the value of If-Match or If-None-Match into its
+// entity-tags. any is set for the "*" value. Invalid members are skipped.
+func ParseETags(v string) (tags []string, any bool) {
+	v = strings.TrimSpace(v)
+	if v == "*" {
+		return nil, true
+	}
+	for _, tag := range strings.Split(v, ",") {
+		tag = strings.TrimSpace(tag)
+		if ValidETag(tag) {
+			tags = append(tags, tag)
+		}
+	}
+	return tags, false
+}
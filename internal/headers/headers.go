@@ -2,13 +2,38 @@ package headers
 
 import (
 	"bytes"
+	"errors"
 	"fmt"
-	"slices"
 	"strings"
 )
 
 const crlf = "\r\n"
 
+var (
+	ErrMalformedHeader    = errors.New("malformed header line")
+	ErrInvalidHeaderName  = errors.New("invalid header name")
+	ErrInvalidHeaderValue = errors.New("invalid header value")
+)
+
+// ParseError describes a header line that couldn't be parsed
+type ParseError struct {
+	Err error
+	// Offset is the position of the offending byte in the data given to Parse
+	Offset int
+	Detail string
+}
+
+func (e *ParseError) Error() string {
+	if e.Detail == "" {
+		return fmt.Sprintf("%v at byte %d", e.Err, e.Offset)
+	}
+	return fmt.Sprintf("%v at byte %d: %s", e.Err, e.Offset, e.Detail)
+}
+
+func (e *ParseError) Unwrap() error {
+	return e.Err
+}
+
 type Headers map[string]string
 
 func NewHeaders() Headers {
@@ -28,69 +53,103 @@ func (h Headers) Parse(data []byte) (n int, done bool, err error) {
 		return 2, true, nil
 	}
 
-	parts := bytes.SplitN(data[:idx], []byte(":"), 2)
-	key := strings.ToLower(string(parts[0]))
+	colon := bytes.IndexByte(data[:idx], ':')
+	if colon == -1 {
+		return 0, false, &ParseError{Err: ErrMalformedHeader, Offset: idx, Detail: "missing colon"}
+	}
 
-	if key != strings.TrimRight(key, " ") {
-		return 0, false, fmt.Errorf("invalid header name: %s", key)
+	// whitespace is allowed before the name but not between the name
+	// and the colon
+	start := len(data[:colon]) - len(bytes.TrimLeft(data[:colon], " \t"))
+	if start == colon {
+		return 0, false, &ParseError{Err: ErrInvalidHeaderName, Offset: colon, Detail: "empty name"}
+	}
+	if i := invalidTokenIndex(data[start:colon]); i != -1 {
+		return 0, false, &ParseError{
+			Err:    ErrInvalidHeaderName,
+			Offset: start + i,
+			Detail: fmt.Sprintf("%q", data[start:colon]),
+		}
 	}
 
-	value := bytes.TrimSpace(parts[1])
-	key = strings.TrimSpace(key)
-	if !validTokens([]byte(key)) {
-		return 0, false, fmt.Errorf("invalid header token found: %s", key)
+	// CR, LF and NUL aren't allowed in a value, RFC 9110 section 5.5. A
+	// bare CR could be taken for a line break by another parser.
+	if i := bytes.IndexAny(data[colon+1:idx], "\r\n\x00"); i != -1 {
+		return 0, false, &ParseError{
+			Err:    ErrInvalidHeaderValue,
+			Offset: colon + 1 + i,
+			Detail: fmt.Sprintf("invalid character %q", data[colon+1+i]),
+		}
 	}
+
+	key := lowerName(data[start:colon])
+	value := bytes.TrimSpace(data[colon+1 : idx])
 	h.Set(key, string(value))
 	return idx + 2, false, nil
 }
 
 func (h Headers) Get(key string) (string, bool) {
-	key = strings.ToLower(key)
+	key = lowerKey(key)
 	v, ok := h[key]
 	return v, ok
 }
 
 func (h Headers) Set(key, value string) {
-	key = strings.ToLower(key)
+	key = lowerKey(key)
 	v, ok := h[key]
 	if ok {
+		// cookie pairs are separated by semicolons, RFC 6265 section 5.4
+		sep := ", "
+		if key == "cookie" {
+			sep = "; "
+		}
 		value = strings.Join([]string{
 			v,
 			value,
-		}, ", ")
+		}, sep)
 	}
 	h[key] = value
 }
 
 func (h Headers) Override(key, value string) {
-	key = strings.ToLower(key)
+	key = lowerKey(key)
 	h[key] = value
 }
 
 func (h Headers) Remove(key string) {
-	key = strings.ToLower(key)
+	key = lowerKey(key)
 	delete(h, key)
 }
 
-var tokenChars = []byte{'!', '#', '$', '%', '&', '\'', '*', '+', '-', '.', '^', '_', '`', '|', '~'}
-
-// validTokens checks if the data contains only valid tokens
-// or characters that are allowed in a token
-func validTokens(data []byte) bool {
-	for _, c := range data {
-		if !isTokenChar(c) {
-			return false
+// HasToken reports whether the comma separated list in the header contains
+// the token, compared case-insensitively as in the Connection header
+func (h Headers) HasToken(key, token string) bool {
+	v, ok := h.Get(key)
+	if !ok {
+		return false
+	}
+	for _, t := range strings.Split(v, ",") {
+		if strings.EqualFold(strings.TrimSpace(t), token) {
+			return true
 		}
 	}
-	return true
+	return false
 }
 
-func isTokenChar(c byte) bool {
-	if c >= 'A' && c <= 'Z' ||
-		c >= 'a' && c <= 'z' ||
-		c >= '0' && c <= '9' {
-		return true
+var tokenChars = []byte{'!', '#', '$', '%', '&', '\'', '*', '+', '-', '.', '^', '_', '`', '|', '~'}
+
+// invalidTokenIndex returns the index of the first byte in data that is
+// not allowed in a token, or -1 if all of them are
+func invalidTokenIndex(data []byte) int {
+	for i, c := range data {
+		if !IsTokenChar(c) {
+			return i
+		}
 	}
+	return -1
+}
 
-	return slices.Contains(tokenChars, c)
+// IsTokenChar reports whether c may appear in a token, RFC 9110 section 5.6.2
+func IsTokenChar(c byte) bool {
+	return tokenTable[c]
 }
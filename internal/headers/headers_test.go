@@ -2,6 +2,7 @@ package headers
 
 import (
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -65,3 +66,325 @@ func TestParse(t *testing.T) {
 	assert.Equal(t, 25, n)
 	assert.False(t, done)
 }
+
+func TestHasToken(t *testing.T) {
+	headers := NewHeaders()
+	headers.Set("Connection", "keep-alive, Upgrade")
+	assert.True(t, headers.HasToken("connection", "upgrade"))
+	assert.True(t, headers.HasToken("Connection", "Keep-Alive"))
+	assert.False(t, headers.HasToken("Connection", "close"))
+	assert.False(t, headers.HasToken("Transfer-Encoding", "chunked"))
+
+	headers.Set("Connection", "close")
+	assert.True(t, headers.HasToken("Connection", "close"))
+}
+
+func TestParseErrors(t *testing.T) {
+	headers := NewHeaders()
+	_, _, err := headers.Parse([]byte("  Ho st: localhost\r\n\r\n"))
+	require.ErrorIs(t, err, ErrInvalidHeaderName)
+	var perr *ParseError
+	require.ErrorAs(t, err, &perr)
+	assert.Equal(t, 4, perr.Offset)
+
+	_, _, err = headers.Parse([]byte("Host localhost\r\n\r\n"))
+	require.ErrorIs(t, err, ErrMalformedHeader)
+	require.ErrorAs(t, err, &perr)
+	assert.Equal(t, 14, perr.Offset)
+
+	_, _, err = headers.Parse([]byte(": localhost\r\n\r\n"))
+	require.ErrorIs(t, err, ErrInvalidHeaderName)
+	require.ErrorAs(t, err, &perr)
+	assert.Equal(t, 0, perr.Offset)
+
+	for _, line := range []string{"X-A: foo\rbar\r\n", "X-A: foo\nbar\r\n", "X-A: foo\x00bar\r\n"} {
+		_, _, err = headers.Parse([]byte(line))
+		require.ErrorIs(t, err, ErrInvalidHeaderValue, "%q", line)
+		require.ErrorAs(t, err, &perr)
+		assert.Equal(t, 8, perr.Offset)
+	}
+	assert.Empty(t, headers)
+}
+
+func TestParseMediaType(t *testing.T) {
+	mediaType, params, err := ParseMediaType("text/HTML; Charset=UTF-8")
+	require.NoError(t, err)
+	assert.Equal(t, "text/html", mediaType)
+	assert.Equal(t, map[string]string{"charset": "UTF-8"}, params)
+
+	mediaType, params, err = ParseMediaType(`multipart/form-data ; boundary="----a \"b\"; c" ;x=1`)
+	require.NoError(t, err)
+	assert.Equal(t, "multipart/form-data", mediaType)
+	assert.Equal(t, map[string]string{"boundary": `----a "b"; c`, "x": "1"}, params)
+
+	mediaType, params, err = ParseMediaType("application/x-www-form-urlencoded")
+	require.NoError(t, err)
+	assert.Equal(t, "application/x-www-form-urlencoded", mediaType)
+	assert.Empty(t, params)
+
+	for _, v := range []string{"", "text", "text/", "te xt/html", "text/html; charset", "text/html; a=\"open", "text/html; a=b c"} {
+		_, _, err = ParseMediaType(v)
+		assert.ErrorIs(t, err, ErrInvalidMediaType, v)
+	}
+}
+
+func TestParseContentDisposition(t *testing.T) {
+	disposition, params, err := ParseContentDisposition(`form-data; name="upload"; filename="my file.txt"`)
+	require.NoError(t, err)
+	assert.Equal(t, "form-data", disposition)
+	assert.Equal(t, map[string]string{"name": "upload", "filename": "my file.txt"}, params)
+
+	disposition, params, err = ParseContentDisposition("Attachment")
+	require.NoError(t, err)
+	assert.Equal(t, "attachment", disposition)
+	assert.Empty(t, params)
+
+	_, _, err = ParseContentDisposition(`form-data; name`)
+	assert.ErrorIs(t, err, ErrInvalidDisposition)
+}
+
+func TestCookie(t *testing.T) {
+	c := &Cookie{
+		Name:        "session",
+		Value:       "abc123",
+		Path:        "/",
+		Domain:      ".example.test",
+		Expires:     time.Date(2030, 1, 2, 3, 4, 5, 0, time.FixedZone("CET", 3600)),
+		MaxAge:      3600,
+		Secure:      true,
+		HttpOnly:    true,
+		SameSite:    SameSiteStrict,
+		Partitioned: true,
+	}
+	require.NoError(t, c.Valid())
+	assert.Equal(t, "session=abc123; Path=/; Domain=example.test; Expires=Wed, 02 Jan 2030 02:04:05 GMT; "+
+		"Max-Age=3600; Secure; HttpOnly; SameSite=Strict; Partitioned", c.String())
+
+	c = &Cookie{Name: "theme", Value: "dark mode", MaxAge: -1, SameSite: SameSiteLax}
+	require.NoError(t, c.Valid())
+	assert.Equal(t, `theme="dark mode"; Max-Age=0; SameSite=Lax`, c.String())
+
+	assert.ErrorIs(t, (&Cookie{Name: "bad name", Value: "x"}).Valid(), ErrInvalidCookie)
+	assert.ErrorIs(t, (&Cookie{Name: "a", Value: "semi;colon"}).Valid(), ErrInvalidCookie)
+	assert.ErrorIs(t, (&Cookie{Name: "a", Path: "/x;y"}).Valid(), ErrInvalidCookie)
+	assert.ErrorIs(t, (&Cookie{Name: "a", Partitioned: true}).Valid(), ErrInvalidCookie)
+}
+
+func TestParseCookie(t *testing.T) {
+	cookies := ParseCookie(`session=abc123; theme="dark mode";bad name=1; empty=; flag`)
+	require.Len(t, cookies, 3)
+	assert.Equal(t, Cookie{Name: "session", Value: "abc123"}, *cookies[0])
+	assert.Equal(t, Cookie{Name: "theme", Value: "dark mode"}, *cookies[1])
+	assert.Equal(t, Cookie{Name: "empty", Value: ""}, *cookies[2])
+
+	// Test: repeated Cookie headers are joined with semicolons
+	headers := NewHeaders()
+	_, _, err := headers.Parse([]byte("Cookie: a=1\r\n"))
+	require.NoError(t, err)
+	_, _, err = headers.Parse([]byte("Cookie: b=2\r\n"))
+	require.NoError(t, err)
+	assert.Equal(t, "a=1; b=2", headers["cookie"])
+	assert.Len(t, ParseCookie(headers["cookie"]), 2)
+}
+
+func BenchmarkParse(b *testing.B) {
+	lines := [][]byte{
+		[]byte("Host: localhost:42069\r\n"),
+		[]byte("User-Agent: curl/7.81.0\r\n"),
+		[]byte("Accept: */*\r\n"),
+		[]byte("Content-Type: application/json\r\n"),
+		[]byte("X-Custom-Header: value\r\n"),
+	}
+	b.ReportAllocs()
+	for range b.N {
+		h := NewHeaders()
+		for _, line := range lines {
+			if _, _, err := h.Parse(line); err != nil {
+				b.Fatal(err)
+			}
+		}
+		if _, ok := h.Get("Content-Type"); !ok {
+			b.Fatal("missing content-type")
+		}
+	}
+}
+
+func TestParseRange(t *testing.T) {
+	tests := []struct {
+		value  string
+		size   int64
+		ranges []ByteRange
+		err    error
+	}{
+		{value: "bytes=0-499", size: 1000, ranges: []ByteRange{{0, 500}}},
+		{value: "bytes=500-", size: 1000, ranges: []ByteRange{{500, 500}}},
+		{value: "bytes=-200", size: 1000, ranges: []ByteRange{{800, 200}}},
+		{value: "bytes=-2000", size: 1000, ranges: []ByteRange{{0, 1000}}},
+		{value: "bytes=900-1999", size: 1000, ranges: []ByteRange{{900, 100}}},
+		{value: "Bytes = 0-0, -1", size: 1000, ranges: []ByteRange{{0, 1}, {999, 1}}},
+		{value: "bytes=0-1,,5-9", size: 1000, ranges: []ByteRange{{0, 2}, {5, 5}}},
+		// unsatisfiable ranges are left out
+		{value: "bytes=0-9,2000-", size: 1000, ranges: []ByteRange{{0, 10}}},
+		{value: "bytes=1000-", size: 1000, err: ErrRangeNotSatisfiable},
+		{value: "bytes=-0", size: 1000, err: ErrRangeNotSatisfiable},
+		{value: "bytes=0-", size: 0, err: ErrRangeNotSatisfiable},
+		{value: "items=0-1", size: 1000, err: ErrInvalidRange},
+		{value: "bytes=", size: 1000, err: ErrInvalidRange},
+		{value: "bytes=5-1", size: 1000, err: ErrInvalidRange},
+		{value: "bytes=a-b", size: 1000, err: ErrInvalidRange},
+		{value: "bytes=-", size: 1000, err: ErrInvalidRange},
+		{value: "bytes=1", size: 1000, err: ErrInvalidRange},
+		{value: "bytes=+1-2", size: 1000, err: ErrInvalidRange},
+		{value: "bytes=0-99999999999999999999", size: 1000, err: ErrInvalidRange},
+	}
+	for _, tt := range tests {
+		ranges, err := ParseRange(tt.value, tt.size)
+		if tt.err != nil {
+			assert.ErrorIs(t, err, tt.err, tt.value)
+			continue
+		}
+		require.NoError(t, err, tt.value)
+		assert.Equal(t, tt.ranges, ranges, tt.value)
+	}
+
+	assert.Equal(t, "bytes 0-499/1000", ByteRange{0, 500}.ContentRange(1000))
+}
+
+func TestParseTime(t *testing.T) {
+	want := time.Date(1994, time.November, 6, 8, 49, 37, 0, time.UTC)
+	for _, s := range []string{
+		"Sun, 06 Nov 1994 08:49:37 GMT",
+		"Sunday, 06-Nov-94 08:49:37 GMT",
+		"Sun Nov  6 08:49:37 1994",
+	} {
+		got, err := ParseTime(s)
+		require.NoError(t, err, s)
+		assert.True(t, want.Equal(got), s)
+	}
+	_, err := ParseTime("yesterday")
+	assert.ErrorIs(t, err, ErrInvalidDate)
+	_, err = ParseTime("Sun, 06 Nov 1994 08:49:37 PST")
+	assert.ErrorIs(t, err, ErrInvalidDate)
+}
+
+func TestETag(t *testing.T) {
+	for _, tag := range []string{`"abc"`, `W/"abc"`, `""`, `"a-b/c"`} {
+		assert.True(t, ValidETag(tag), tag)
+	}
+	for _, tag := range []string{`abc`, `"abc`, `w/"abc"`, `"a"b"`, `"a b"`, `W/`, `"`} {
+		assert.False(t, ValidETag(tag), tag)
+	}
+
+	// the examples of RFC 9110 section 8.8.3.2
+	tests := []struct {
+		a, b          string
+		strong, weakM bool
+	}{
+		{a: `W/"1"`, b: `W/"1"`, strong: false, weakM: true},
+		{a: `W/"1"`, b: `W/"2"`, strong: false, weakM: false},
+		{a: `W/"1"`, b: `"1"`, strong: false, weakM: true},
+		{a: `"1"`, b: `"1"`, strong: true, weakM: true},
+	}
+	for _, tt := range tests {
+		assert.Equal(t, tt.strong, ETagStrongMatch(tt.a, tt.b), "%s %s", tt.a, tt.b)
+		assert.Equal(t, tt.weakM, ETagWeakMatch(tt.a, tt.b), "%s %s", tt.a, tt.b)
+	}
+
+	tags, any := ParseETags(`"a", W/"b" , bad,"c"`)
+	assert.Equal(t, []string{`"a"`, `W/"b"`, `"c"`}, tags)
+	assert.False(t, any)
+	tags, any = ParseETags(" * ")
+	assert.Nil(t, tags)
+	assert.True(t, any)
+}
+
+func TestParseAccept(t *testing.T) {
+	ranges := ParseAccept(`text/html, Application/JSON;q=0.5, text/*;level=1;q=0.2;ext=x, */html, image/png;q=2, */*;q=0`)
+	assert.Equal(t, []AcceptRange{
+		{Value: "text/html", Params: map[string]string{}, Q: 1},
+		{Value: "application/json", Params: map[string]string{}, Q: 0.5},
+		{Value: "text/*", Params: map[string]string{"level": "1"}, Q: 0.2},
+		{Value: "*/*", Params: map[string]string{}, Q: 0},
+	}, ranges)
+
+	list := ParseAcceptList(`gzip;q=1.0, Identity; Q=0.5, br;q=0.1234, *;q=0, en-US;q=0.`)
+	assert.Equal(t, []AcceptRange{
+		{Value: "gzip", Q: 1},
+		{Value: "identity", Q: 0.5},
+		{Value: "*", Q: 0},
+		{Value: "en-us", Q: 0},
+	}, list)
+}
+
+func TestAcceptQuality(t *testing.T) {
+	// the example of RFC 9110 section 12.5.1
+	types := ParseAccept(`text/*;q=0.3, text/plain;q=0.7, text/plain;format=flowed, text/plain;format=fixed;q=0.4, */*;q=0.5`)
+	for mediaType, q := range map[string]float64{
+		"text/plain;format=flowed": 1,
+		"text/plain":               0.7,
+		"text/html":                0.3,
+		"image/jpeg":               0.5,
+		"text/plain;format=fixed":  0.4,
+		"text/html;level=3":        0.3,
+		"not a type":               0,
+	} {
+		assert.Equal(t, q, MediaTypeQuality(types, mediaType), mediaType)
+	}
+	assert.Equal(t, 1.0, MediaTypeQuality(ParseAccept("text/html;charset=utf-8"), "text/html; charset=UTF-8"))
+	assert.Equal(t, 0.0, MediaTypeQuality(ParseAccept("text/html"), "text/plain"))
+
+	encodings := ParseAcceptList("gzip, br;q=0.5")
+	assert.Equal(t, 1.0, EncodingQuality(encodings, "GZIP"))
+	assert.Equal(t, 0.5, EncodingQuality(encodings, "br"))
+	assert.Equal(t, 0.0, EncodingQuality(encodings, "deflate"))
+	assert.Equal(t, 1.0, EncodingQuality(encodings, "identity"))
+	assert.Equal(t, 1.0, EncodingQuality(nil, "identity"))
+	assert.Equal(t, 0.0, EncodingQuality(ParseAcceptList("*;q=0"), "identity"))
+	assert.Equal(t, 0.0, EncodingQuality(ParseAcceptList("identity;q=0"), "identity"))
+	assert.Equal(t, 0.8, EncodingQuality(ParseAcceptList("*;q=0.8"), "deflate"))
+
+	languages := ParseAcceptList("fr-CH, fr;q=0.9, en;q=0.8, *;q=0.5")
+	assert.Equal(t, 1.0, LanguageQuality(languages, "fr-ch"))
+	assert.Equal(t, 0.9, LanguageQuality(languages, "fr-FR"))
+	assert.Equal(t, 0.8, LanguageQuality(languages, "en-GB"))
+	assert.Equal(t, 0.5, LanguageQuality(languages, "de"))
+	// "en" is a prefix but not a subtag of "eng"
+	assert.Equal(t, 0.0, LanguageQuality(ParseAcceptList("en"), "eng"))
+}
+
+func TestParseCredentials(t *testing.T) {
+	c, err := ParseCredentials("Basic QWxhZGRpbjpvcGVuIHNlc2FtZQ==")
+	require.NoError(t, err)
+	assert.Equal(t, &Credentials{Scheme: "basic", Token68: "QWxhZGRpbjpvcGVuIHNlc2FtZQ=="}, c)
+
+	c, err = ParseCredentials(`Digest  username="Mufasa", Realm = "http\"auth", ,nc=00000001`)
+	require.NoError(t, err)
+	assert.Equal(t, "digest", c.Scheme)
+	assert.Equal(t, map[string]string{"username": "Mufasa", "realm": `http"auth`, "nc": "00000001"}, c.Params)
+
+	c, err = ParseCredentials("Negotiate")
+	require.NoError(t, err)
+	assert.Equal(t, &Credentials{Scheme: "negotiate"}, c)
+
+	for _, v := range []string{
+		"",
+		"Basic abc==def",
+		`Digest realm="a", realm="b"`,
+		`Digest realm="a`,
+		"Digest realm=a b",
+		"Bearer =abc",
+		"B@sic abc",
+	} {
+		_, err := ParseCredentials(v)
+		assert.ErrorIs(t, err, ErrInvalidCredentials, v)
+	}
+}
+
+func TestChallenge(t *testing.T) {
+	c := Challenge{Scheme: "Basic", Params: map[string]string{"realm": "internal", "charset": "UTF-8"}}
+	assert.Equal(t, `Basic realm="internal", charset="UTF-8"`, c.String())
+	c = Challenge{Scheme: "Bearer", Params: map[string]string{"error": "invalid_token", "error_description": `say "please"`}}
+	assert.Equal(t, `Bearer error="invalid_token", error_description="say \"please\""`, c.String())
+	assert.Equal(t, "Negotiate abc==", Challenge{Scheme: "Negotiate", Token68: "abc=="}.String())
+	assert.Equal(t, "Negotiate", Challenge{Scheme: "Negotiate"}.String())
+}
@@ -0,0 +1,119 @@
+package headers
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+var (
+	ErrInvalidMediaType   = errors.New("invalid media type")
+	ErrInvalidDisposition = errors.New("invalid content disposition")
+)
+
+// ParseMediaType parses a Content-Type style value such as
+// `text/html; charset="utf-8"`. The media type and parameter names are
+// lower-cased, parameter values are unquoted.
+func ParseMediaType(v string) (string, map[string]string, error) {
+	mediaType, rest, _ := strings.Cut(v, ";")
+	mediaType = strings.ToLower(strings.TrimSpace(mediaType))
+	typ, subtype, ok := strings.Cut(mediaType, "/")
+	if !ok || !isToken(typ) || !isToken(subtype) {
+		return "", nil, ErrInvalidMediaType
+	}
+
+	params, err := parseParams(rest)
+	if err != nil {
+		return "", nil, ErrInvalidMediaType
+	}
+	return mediaType, params, nil
+}
+
+// ParseContentDisposition parses a Content-Disposition value such as
+// `form-data; name="file"; filename="a.txt"`. The disposition type and
+// parameter names are lower-cased, parameter values are unquoted.
+func ParseContentDisposition(v string) (string, map[string]string, error) {
+	disposition, rest, _ := strings.Cut(v, ";")
+	disposition = strings.ToLower(strings.TrimSpace(disposition))
+	if !isToken(disposition) {
+		return "", nil, ErrInvalidDisposition
+	}
+	params, err := parseParams(rest)
+	if err != nil {
+		return "", nil, ErrInvalidDisposition
+	}
+	return disposition, params, nil
+}
+
+// parseParams parses the `; name=value` list that follows a media type or
+// disposition type
+func parseParams(s string) (map[string]string, error) {
+	params := map[string]string{}
+	for {
+		s = strings.TrimLeft(s, " \t")
+		if s == "" {
+			return params, nil
+		}
+		if s[0] == ';' {
+			s = s[1:]
+			continue
+		}
+		name, value, ok := strings.Cut(s, "=")
+		name = strings.ToLower(strings.TrimSpace(name))
+		if !ok || !isToken(name) {
+			return nil, fmt.Errorf("invalid parameter name %q", name)
+		}
+		value, s, ok = consumeValue(value)
+		if !ok {
+			return nil, fmt.Errorf("invalid value for parameter %q", name)
+		}
+		params[name] = value
+		s = strings.TrimLeft(s, " \t")
+		if s != "" && s[0] != ';' {
+			return nil, fmt.Errorf("unexpected %q after parameter %q", s, name)
+		}
+	}
+}
+
+// consumeValue reads a token or quoted-string from the start of s and
+// returns it with the rest of s
+func consumeValue(s string) (value, rest string, ok bool) {
+	if strings.HasPrefix(s, `"`) {
+		return consumeQuotedString(s)
+	}
+	end := strings.IndexFunc(s, func(r rune) bool {
+		return r > 0x7f || !IsTokenChar(byte(r))
+	})
+	if end == -1 {
+		end = len(s)
+	}
+	if end == 0 {
+		return "", s, false
+	}
+	return s[:end], s[end:], true
+}
+
+// consumeQuotedString reads a quoted-string from the start of s, removing
+// the quotes and backslash escapes
+func consumeQuotedString(s string) (value, rest string, ok bool) {
+	var b strings.Builder
+	for i := 1; i < len(s); i++ {
+		switch c := s[i]; c {
+		case '"':
+			return b.String(), s[i+1:], true
+		case '\\':
+			if i+1 == len(s) {
+				return "", s, false
+			}
+			i++
+			b.WriteByte(s[i])
+		default:
+			b.WriteByte(c)
+		}
+	}
+	return "", s, false
+}
+
+func isToken(s string) bool {
+	return s != "" && invalidTokenIndex([]byte(s)) == -1
+}
@@ -0,0 +1,73 @@
+package headers
+
+import "strings"
+
+// commonNames holds the lower case names of fields most requests send.
+// Parsing one of them reuses the string from this table instead of
+// allocating a new one.
+var commonNames = map[string]string{}
+
+func init() {
+	for _, name := range []string{
+		"accept", "accept-charset", "accept-encoding", "accept-language",
+		"authorization", "cache-control", "connection", "content-disposition",
+		"content-encoding", "content-length", "content-range", "content-type",
+		"cookie", "date", "etag", "expect", "host", "if-match",
+		"if-modified-since", "if-none-match", "if-range", "if-unmodified-since",
+		"keep-alive", "last-modified", "location", "origin", "pragma", "range",
+		"referer", "server", "set-cookie", "te", "trailer", "transfer-encoding",
+		"upgrade", "user-agent", "vary", "x-forwarded-for", "x-forwarded-proto",
+		"x-request-id",
+	} {
+		commonNames[name] = name
+	}
+}
+
+// maxInternedName is longer than any name in commonNames
+const maxInternedName = 32
+
+// lowerName returns the lower case form of an ASCII field name
+func lowerName[T string | []byte](name T) string {
+	if len(name) > maxInternedName {
+		return strings.ToLower(string(name))
+	}
+	var buf [maxInternedName]byte
+	for i := 0; i < len(name); i++ {
+		c := name[i]
+		if 'A' <= c && c <= 'Z' {
+			c += 'a' - 'A'
+		}
+		buf[i] = c
+	}
+	// the conversion in the map index doesn't allocate
+	if s, ok := commonNames[string(buf[:len(name)])]; ok {
+		return s
+	}
+	return string(buf[:len(name)])
+}
+
+// lowerKey is lowerName for keys passed to the Headers methods, which are
+// usually lower case already
+func lowerKey(key string) string {
+	for i := 0; i < len(key); i++ {
+		if 'A' <= key[i] && key[i] <= 'Z' {
+			return lowerName(key)
+		}
+	}
+	return key
+}
+
+// tokenTable marks the bytes allowed in a token, RFC 9110 section 5.6.2
+var tokenTable = func() (t [256]bool) {
+	for c := '0'; c <= '9'; c++ {
+		t[c] = true
+	}
+	for c := 'a'; c <= 'z'; c++ {
+		t[c] = true
+		t[c-'a'+'A'] = true
+	}
+	for _, c := range tokenChars {
+		t[c] = true
+	}
+	return t
+}()
@@ -0,0 +1,101 @@
+package headers
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+var (
+	ErrInvalidRange        = errors.New("invalid range")
+	ErrRangeNotSatisfiable = errors.New("range not satisfiable")
+)
+
+// ByteRange is the Length bytes of a representation starting at Start
+type ByteRange struct {
+	Start  int64
+	Length int64
+}
+
+// ContentRange returns the Content-Range value of the range for a
+// representation of size bytes
+func (r ByteRange) ContentRange(size int64) string {
+	return fmt.Sprintf("bytes %d-%d/%d", r.Start, r.Start+r.Length-1, size)
+}
+
+// ParseRange parses a Range header as in RFC 9110 section 14.1.2 for a
+// representation of size bytes. Last positions past the end are cut to
+// the size and suffix ranges count from the end. Ranges that start past
+// the end are left out, ErrRangeNotSatisfiable is returned when that
+// leaves none. A header that doesn't parse returns ErrInvalidRange, the
+// server should then ignore it.
+func ParseRange(s string, size int64) ([]ByteRange, error) {
+	unit, set, ok := strings.Cut(s, "=")
+	if !ok || !strings.EqualFold(strings.TrimSpace(unit), "bytes") {
+		return nil, fmt.Errorf("%w: %q", ErrInvalidRange, s)
+	}
+	var ranges []ByteRange
+	specs := 0
+	for _, spec := range strings.Split(set, ",") {
+		spec = strings.TrimSpace(spec)
+		if spec == "" {
+			continue
+		}
+		specs++
+		first, last, ok := strings.Cut(spec, "-")
+		if !ok {
+			return nil, fmt.Errorf("%w: %q", ErrInvalidRange, spec)
+		}
+		if first == "" {
+			// suffix-range, the last n bytes
+			n, ok := parsePosition(last)
+			if !ok {
+				return nil, fmt.Errorf("%w: %q", ErrInvalidRange, spec)
+			}
+			if n == 0 || size == 0 {
+				continue
+			}
+			n = min(n, size)
+			ranges = append(ranges, ByteRange{Start: size - n, Length: n})
+			continue
+		}
+		start, ok := parsePosition(first)
+		if !ok {
+			return nil, fmt.Errorf("%w: %q", ErrInvalidRange, spec)
+		}
+		end := size - 1
+		if last != "" {
+			n, ok := parsePosition(last)
+			if !ok || n < start {
+				return nil, fmt.Errorf("%w: %q", ErrInvalidRange, spec)
+			}
+			end = min(n, end)
+		}
+		if start >= size {
+			continue
+		}
+		ranges = append(ranges, ByteRange{Start: start, Length: end - start + 1})
+	}
+	if specs == 0 {
+		return nil, fmt.Errorf("%w: %q", ErrInvalidRange, s)
+	}
+	if len(ranges) == 0 {
+		return nil, fmt.Errorf("%w: %q of %d bytes", ErrRangeNotSatisfiable, s, size)
+	}
+	return ranges, nil
+}
+
+// parsePosition parses the digits of a first-pos, last-pos or suffix-length
+func parsePosition(s string) (int64, bool) {
+	if s == "" {
+		return 0, false
+	}
+	for i := 0; i < len(s); i++ {
+		if s[i] < '0' || s[i] > '9' {
+			return 0, false
+		}
+	}
+	n, err := strconv.ParseInt(s, 10, 64)
+	return n, err == nil
+}
@@ -0,0 +1,44 @@
+package request
+
+import (
+	"encoding/base64"
+	"errors"
+	"strings"
+
+	"github.com/P-H-Pancholi/httpfromtcp/internal/headers"
+)
+
+var ErrNoAuthorization = errors.New("authorization header not present")
+
+// Authorization returns the parsed credentials of the Authorization header
+func (r *Request) Authorization() (*headers.Credentials, error) {
+	v, ok := r.Headers.Get("Authorization")
+	if !ok {
+		return nil, ErrNoAuthorization
+	}
+	return headers.ParseCredentials(v)
+}
+
+// BasicAuth returns the user-id and password of Basic credentials, RFC
+// 7617. ok is false when there are none or they don't decode.
+func (r *Request) BasicAuth() (user, password string, ok bool) {
+	c, err := r.Authorization()
+	if err != nil || c.Scheme != "basic" || c.Token68 == "" {
+		return "", "", false
+	}
+	decoded, err := base64.StdEncoding.DecodeString(c.Token68)
+	if err != nil {
+		return "", "", false
+	}
+	// the user-id can't contain a colon, the password can
+	return strings.Cut(string(decoded), ":")
+}
+
+// BearerToken returns the token of Bearer credentials, RFC 6750
+func (r *Request) BearerToken() (string, bool) {
+	c, err := r.Authorization()
+	if err != nil || c.Scheme != "bearer" || c.Token68 == "" {
+		return "", false
+	}
+	return c.Token68, true
+}
@@ -0,0 +1,112 @@
+package request
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// body reads a request body straight from the connection with the
+// Content-Length or chunked framing removed
+type body struct {
+	reader *Reader
+	req    *Request
+	err    error
+	closed bool
+}
+
+func (b *body) Read(p []byte) (int, error) {
+	if b.closed {
+		return 0, errors.New("error: read on closed body")
+	}
+	if b.err != nil {
+		return 0, b.err
+	}
+	if fn := b.req.onBodyRead; fn != nil {
+		b.req.onBodyRead = nil
+		fn()
+	}
+	for len(b.req.pending) == 0 {
+		if b.req.State == Done {
+			return 0, io.EOF
+		}
+		if err := b.reader.advance(b.req); err != nil {
+			b.err = err
+			return 0, err
+		}
+	}
+	n := copy(p, b.req.pending)
+	b.req.pending = b.req.pending[n:]
+	return n, nil
+}
+
+// Close discards the unread rest of the body so the next request on the
+// connection can be read
+func (b *body) Close() error {
+	if b.closed {
+		return nil
+	}
+	// skipping the body doesn't count as reading it
+	b.req.onBodyRead = nil
+	_, err := io.Copy(io.Discard, b)
+	b.closed = true
+	return err
+}
+
+// OnBodyRead sets a function that is called once, right before the body is
+// first read from the connection. The server uses it to send 100 Continue
+// only when the handler actually wants the body.
+func (r *Request) OnBodyRead(fn func()) {
+	r.onBodyRead = fn
+}
+
+// ExpectsContinue reports whether the client waits for a 100 Continue
+// response before sending the body. An Expect header with anything other
+// than 100-continue returns ErrUnsupportedExpectation. HTTP/1.0 clients
+// don't understand 100 Continue, so their Expect header is ignored.
+func (r *Request) ExpectsContinue() (bool, error) {
+	expect, ok := r.Headers.Get("Expect")
+	if !ok || r.RequestLine.HttpVersion == "1.0" {
+		return false, nil
+	}
+	if !strings.EqualFold(strings.TrimSpace(expect), "100-continue") {
+		return false, fmt.Errorf("%w: %q", ErrUnsupportedExpectation, expect)
+	}
+	return true, nil
+}
+
+// appendBody queues decoded body bytes for the body reader
+func (r *Request) appendBody(data []byte) {
+	r.pending = append(r.pending, data...)
+	r.bodyRead += len(data)
+}
+
+// BodyReader returns a reader for the request body. For a request read with
+// ReadRequestHeader the body is streamed from the connection, otherwise it
+// reads from Body.
+func (r *Request) BodyReader() io.ReadCloser {
+	if r.body != nil {
+		return r.body
+	}
+	return io.NopCloser(bytes.NewReader(r.Body))
+}
+
+// ReadBody reads the rest of a streamed body into Body and returns it
+func (r *Request) ReadBody() ([]byte, error) {
+	if r.body == nil {
+		return r.Body, nil
+	}
+	data, err := io.ReadAll(r.body)
+	if len(r.Body) == 0 {
+		r.Body = data
+	} else {
+		r.Body = append(r.Body, data...)
+	}
+	if err != nil {
+		return r.Body, err
+	}
+	r.body = nil
+	return r.Body, nil
+}
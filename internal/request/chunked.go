@@ -0,0 +1,200 @@
+package request
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/P-H-Pancholi/httpfromtcp/internal/headers"
+)
+
+const crlf = "\r\n"
+
+// maxChunkSize guards against chunk-size values that would overflow
+const maxChunkSize = 1<<31 - 1
+
+// maxChunkLineBytes bounds a chunk-size line including its extensions
+const maxChunkLineBytes = 4 << 10
+
+// checkTransferEncoding validates a Transfer-Encoding field value. Chunked
+// is the only coding understood and it must be applied exactly once, RFC
+// 9112 section 6.3 leaves the body length undeterminable otherwise.
+func checkTransferEncoding(te string) error {
+	codings := strings.Split(te, ",")
+	for _, c := range codings {
+		c = strings.TrimSpace(c)
+		if c == "" {
+			return ErrInvalidTransferEncoding
+		}
+		if !strings.EqualFold(c, "chunked") {
+			return ErrUnsupportedTransferEncoding
+		}
+	}
+	if len(codings) != 1 {
+		return ErrInvalidTransferEncoding
+	}
+	return nil
+}
+
+// parseChunked decodes a chunked body as described in RFC 9112 section 7.1
+//
+//	chunked-body = *chunk last-chunk trailer-section CRLF
+//	chunk        = chunk-size [ chunk-ext ] CRLF chunk-data CRLF
+//	last-chunk   = 1*("0") [ chunk-ext ] CRLF
+func (r *Request) parseChunked(data []byte) (int, error) {
+	switch r.State {
+	case parseChunkSize:
+		if lineLength(data) > maxChunkLineBytes {
+			return 0, r.parseError(ErrMalformedChunk, maxChunkLineBytes, "chunk size line too long")
+		}
+		idx := bytes.Index(data, []byte(crlf))
+		if idx == -1 {
+			return 0, nil
+		}
+		size, err := parseChunkSizeLine(data[:idx])
+		if err != nil {
+			return 0, r.parseError(ErrMalformedChunk, 0, "%v", err)
+		}
+		if max := r.limits.MaxBodyBytes; max > 0 && r.bodyRead+size > max {
+			return 0, r.parseError(ErrBodyTooLarge, 0, "limit is %d bytes", max)
+		}
+		if size == 0 {
+			r.State = parseChunkTrailer
+		} else {
+			r.chunkRemaining = size
+			r.State = parseChunkData
+		}
+		return idx + 2, nil
+	case parseChunkData:
+		n := min(len(data), r.chunkRemaining)
+		r.appendBody(data[:n])
+		r.chunkRemaining -= n
+		if r.chunkRemaining == 0 {
+			r.State = parseChunkDataEnd
+		}
+		return n, nil
+	case parseChunkDataEnd:
+		if len(data) < 2 {
+			return 0, nil
+		}
+		if !bytes.HasPrefix(data, []byte(crlf)) {
+			return 0, r.parseError(ErrMalformedChunk, 0, "chunk data not terminated by CRLF")
+		}
+		r.State = parseChunkSize
+		return 2, nil
+	case parseChunkTrailer:
+		// the trailer section counts towards the header limit
+		if max := r.limits.MaxHeaderBytes; max > 0 && r.headerBytes+lineLength(data) > max {
+			return 0, r.parseError(ErrHeadersTooLarge, max-r.headerBytes, "limit is %d bytes", max)
+		}
+		if err := r.checkObsFold(data); err != nil {
+			return 0, err
+		}
+		idx := bytes.Index(data, []byte(crlf))
+		if idx == -1 {
+			return 0, nil
+		}
+		if idx == 0 {
+			r.headerBytes += 2
+			r.State = Done
+			return 2, nil
+		}
+		if err := r.parseTrailer(data[:idx+2]); err != nil {
+			return 0, err
+		}
+		r.headerBytes += idx + 2
+		return idx + 2, nil
+	default:
+		return 0, fmt.Errorf("error: unknown chunked state")
+	}
+}
+
+// parseTrailer adds a trailer field line to Trailers. Fields that weren't
+// declared in the Trailer header are dropped, fields that would change how
+// the request is framed, routed or handled are rejected.
+func (r *Request) parseTrailer(line []byte) error {
+	h := headers.NewHeaders()
+	if _, _, err := h.Parse(line); err != nil {
+		var herr *headers.ParseError
+		if errors.As(err, &herr) {
+			return r.parseError(herr.Err, herr.Offset, "%s", herr.Detail)
+		}
+		return err
+	}
+	r.headerCount++
+	if max := r.limits.MaxHeaderCount; max > 0 && r.headerCount > max {
+		return r.parseError(ErrTooManyHeaders, 0, "limit is %d headers", max)
+	}
+	for name, value := range h {
+		if forbiddenTrailers[name] {
+			return r.parseError(ErrInvalidTrailer, 0, "%q is not allowed in trailers", name)
+		}
+		if r.Headers.HasToken("Trailer", name) {
+			r.Trailers.Set(name, value)
+		}
+	}
+	return nil
+}
+
+// forbiddenTrailers are the fields a sender must not put in the trailer
+// section, RFC 9110 section 6.5.1
+var forbiddenTrailers = map[string]bool{
+	// message framing
+	"transfer-encoding": true,
+	"content-length":    true,
+	"trailer":           true,
+	"te":                true,
+	"connection":        true,
+	"keep-alive":        true,
+	"upgrade":           true,
+	// routing
+	"host": true,
+	// request modifiers
+	"expect":              true,
+	"max-forwards":        true,
+	"cache-control":       true,
+	"pragma":              true,
+	"range":               true,
+	"if-match":            true,
+	"if-none-match":       true,
+	"if-modified-since":   true,
+	"if-unmodified-since": true,
+	"if-range":            true,
+	"authorization":       true,
+	"proxy-authorization": true,
+	"cookie":              true,
+	// content handling
+	"content-encoding": true,
+	"content-type":     true,
+	"content-range":    true,
+}
+
+// parseChunkSizeLine returns the size from a chunk-size line, ignoring
+// any chunk extensions
+func parseChunkSizeLine(line []byte) (int, error) {
+	if i := bytes.IndexByte(line, ';'); i != -1 {
+		line = line[:i]
+	}
+	line = bytes.TrimRight(line, " \t")
+	if len(line) == 0 {
+		return 0, fmt.Errorf("missing chunk size")
+	}
+	for _, c := range line {
+		if !isHexDigit(c) {
+			return 0, fmt.Errorf("invalid chunk size %q", line)
+		}
+	}
+	size, err := strconv.ParseInt(string(line), 16, 64)
+	if err != nil || size > maxChunkSize {
+		return 0, fmt.Errorf("chunk size too large %q", line)
+	}
+	return int(size), nil
+}
+
+func isHexDigit(c byte) bool {
+	return c >= '0' && c <= '9' ||
+		c >= 'a' && c <= 'f' ||
+		c >= 'A' && c <= 'F'
+}
@@ -0,0 +1,73 @@
+package request
+
+import (
+	"time"
+
+	"github.com/P-H-Pancholi/httpfromtcp/internal/headers"
+)
+
+// Precondition is the outcome of evaluating the conditional headers of a
+// request against the current state of the target resource
+type Precondition int
+
+const (
+	// PreconditionPassed means the request is handled as usual
+	PreconditionPassed Precondition = iota
+	// PreconditionNotModified means the client's cached copy is current
+	// and 304 Not Modified is sent
+	PreconditionNotModified
+	// PreconditionFailed means 412 Precondition Failed is sent
+	PreconditionFailed
+)
+
+// EvaluatePreconditions evaluates If-Match, If-Unmodified-Since,
+// If-None-Match and If-Modified-Since in the order of RFC 9110 section
+// 13.2.2. etag and modTime describe the selected representation, an empty
+// etag or a zero modTime means the resource doesn't have that validator.
+// If-Range is left to Ranges.
+func (r *Request) EvaluatePreconditions(etag string, modTime time.Time) Precondition {
+	method := r.RequestLine.Method
+	getOrHead := method == MethodGet || method == MethodHead
+	modTime = modTime.Truncate(time.Second)
+	exists := etag != "" || !modTime.IsZero()
+
+	if v, ok := r.Headers.Get("If-Match"); ok {
+		tags, any := headers.ParseETags(v)
+		if !matchETag(tags, any, exists, etag, headers.ETagStrongMatch) {
+			return PreconditionFailed
+		}
+	} else if v, ok := r.Headers.Get("If-Unmodified-Since"); ok && !modTime.IsZero() {
+		if t, err := headers.ParseTime(v); err == nil && modTime.After(t) {
+			return PreconditionFailed
+		}
+	}
+
+	if v, ok := r.Headers.Get("If-None-Match"); ok {
+		tags, any := headers.ParseETags(v)
+		if matchETag(tags, any, exists, etag, headers.ETagWeakMatch) {
+			if getOrHead {
+				return PreconditionNotModified
+			}
+			return PreconditionFailed
+		}
+	} else if v, ok := r.Headers.Get("If-Modified-Since"); ok && getOrHead && !modTime.IsZero() {
+		if t, err := headers.ParseTime(v); err == nil && !modTime.After(t) {
+			return PreconditionNotModified
+		}
+	}
+	return PreconditionPassed
+}
+
+// matchETag reports whether etag is one of tags with the given comparison.
+// "*" matches whenever the resource exists.
+func matchETag(tags []string, any, exists bool, etag string, match func(a, b string) bool) bool {
+	if any {
+		return exists
+	}
+	for _, tag := range tags {
+		if match(tag, etag) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,26 @@
+package request
+
+import "context"
+
+// Context returns the request's context. For requests served by
+// server.Server it is cancelled when the client disconnects, the server is
+// closed, the request deadline passes or the handler returns. It is never
+// nil, requests read directly use context.Background.
+func (r *Request) Context() context.Context {
+	if r.ctx != nil {
+		return r.ctx
+	}
+	return context.Background()
+}
+
+// WithContext returns a shallow copy of the request using ctx, which lets
+// middleware attach values or deadlines for the handlers it calls
+func (r *Request) WithContext(ctx context.Context) *Request {
+	if ctx == nil {
+		panic("nil context")
+	}
+	r2 := new(Request)
+	*r2 = *r
+	r2.ctx = ctx
+	return r2
+}
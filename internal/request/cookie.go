@@ -0,0 +1,28 @@
+package request
+
+import (
+	"errors"
+
+	"github.com/P-H-Pancholi/httpfromtcp/internal/headers"
+)
+
+var ErrNoCookie = errors.New("named cookie not present")
+
+// Cookies returns the cookies sent in the Cookie header
+func (r *Request) Cookies() []*headers.Cookie {
+	v, ok := r.Headers.Get("Cookie")
+	if !ok {
+		return nil
+	}
+	return headers.ParseCookie(v)
+}
+
+// Cookie returns the first cookie with the given name
+func (r *Request) Cookie(name string) (*headers.Cookie, error) {
+	for _, c := range r.Cookies() {
+		if c.Name == name {
+			return c, nil
+		}
+	}
+	return nil, ErrNoCookie
+}
@@ -0,0 +1,125 @@
+package request
+
+import (
+	"compress/gzip"
+	"compress/zlib"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// DecompressBody removes the gzip or deflate content coding of the body,
+// so BodyReader and ReadBody return the decoded bytes. The Content-Encoding
+// and Content-Length headers are removed as they no longer describe the
+// body, Content-Length is kept when no coding other than identity was
+// applied. Codings other than gzip, deflate and identity return
+// ErrUnsupportedContentEncoding, and reading more than MaxDecompressedBytes
+// of decoded body fails with ErrBodyTooLarge.
+func (r *Request) DecompressBody() error {
+	ce, ok := r.Headers.Get("Content-Encoding")
+	if !ok {
+		return nil
+	}
+	var codings []string
+	for _, c := range strings.Split(ce, ",") {
+		c = strings.ToLower(strings.TrimSpace(c))
+		switch c {
+		case "identity", "":
+		case "gzip", "x-gzip", "deflate":
+			codings = append(codings, c)
+		default:
+			return fmt.Errorf("%w: %q", ErrUnsupportedContentEncoding, c)
+		}
+	}
+	r.Headers.Remove("Content-Encoding")
+	if len(codings) == 0 {
+		// identity leaves the body as it is, its length still holds
+		return nil
+	}
+	r.Headers.Remove("Content-Length")
+
+	d := &decodedBody{
+		raw:     r.BodyReader(),
+		codings: codings,
+		limit:   r.limits.MaxDecompressedBytes,
+	}
+	if r.body != nil {
+		r.body = d
+		return nil
+	}
+	// the body has been read already
+	data, err := io.ReadAll(d)
+	if err != nil {
+		return err
+	}
+	r.Body = data
+	return nil
+}
+
+// decodedBody removes the content codings from a body. The decoders are
+// only set up on the first read, as they read the start of the body.
+type decodedBody struct {
+	raw io.ReadCloser
+	// codings are listed in the order they were applied
+	codings []string
+	limit   int
+	r       io.Reader
+	err     error
+}
+
+func (d *decodedBody) Read(p []byte) (int, error) {
+	if d.err != nil {
+		return 0, d.err
+	}
+	if d.r == nil {
+		if err := d.init(); err != nil {
+			d.err = decodeError(err)
+			return 0, d.err
+		}
+	}
+	n, err := d.r.Read(p)
+	if err != nil && err != io.EOF {
+		d.err = decodeError(err)
+		return n, d.err
+	}
+	return n, err
+}
+
+func (d *decodedBody) init() error {
+	r := io.Reader(d.raw)
+	for i := len(d.codings) - 1; i >= 0; i-- {
+		var err error
+		switch d.codings[i] {
+		case "gzip", "x-gzip":
+			r, err = gzip.NewReader(r)
+		case "deflate":
+			// the deflate coding is the zlib format, RFC 9110
+			// section 8.4.1.2
+			r, err = zlib.NewReader(r)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	if d.limit > 0 {
+		r = &limitedReader{r: r, n: d.limit, err: ErrBodyTooLarge}
+	}
+	d.r = r
+	return nil
+}
+
+// Close skips the rest of the encoded body
+func (d *decodedBody) Close() error {
+	return d.raw.Close()
+}
+
+// decodeError marks errors of the decoders as ErrMalformedContentEncoding,
+// errors reading the body itself are returned as they are
+func decodeError(err error) error {
+	var perr *ParseError
+	if errors.Is(err, ErrBodyTooLarge) || errors.As(err, &perr) {
+		return err
+	}
+	return fmt.Errorf("%w: %w", ErrMalformedContentEncoding, err)
+}
@@ -0,0 +1,69 @@
+package request
+
+import (
+	"errors"
+	"fmt"
+)
+
+var (
+	ErrMalformedRequestLine        = errors.New("malformed request line")
+	ErrInvalidMethod               = errors.New("invalid method")
+	ErrInvalidTarget               = errors.New("invalid request target")
+	ErrMissingHost                 = errors.New("missing host header")
+	ErrInvalidHost                 = errors.New("invalid host header")
+	ErrUnsupportedVersion          = errors.New("unsupported http version")
+	ErrInvalidContentLength        = errors.New("invalid content-length")
+	ErrUnsupportedTransferEncoding = errors.New("unsupported transfer-encoding")
+	ErrInvalidTransferEncoding     = errors.New("invalid transfer-encoding")
+	ErrConflictingLength           = errors.New("both content-length and transfer-encoding")
+	ErrObsoleteFold                = errors.New("obsolete line folding")
+	ErrMalformedChunk              = errors.New("malformed chunk")
+	ErrInvalidTrailer              = errors.New("invalid trailer field")
+	ErrRequestLineTooLong          = errors.New("request line too long")
+	ErrHeadersTooLarge             = errors.New("request headers too large")
+	ErrTooManyHeaders              = errors.New("too many request headers")
+	ErrBodyTooLarge                = errors.New("request body too large")
+	ErrFormTooLarge                = errors.New("form body too large")
+	ErrMalformedForm               = errors.New("malformed form")
+	ErrNotMultipart                = errors.New("request content-type is not multipart/form-data")
+	ErrMalformedMultipart          = errors.New("malformed multipart body")
+	ErrPartTooLarge                = errors.New("multipart part too large")
+	ErrMultipartTooLarge           = errors.New("multipart body too large")
+	ErrUnsupportedExpectation      = errors.New("unsupported expectation")
+	ErrUnsupportedContentEncoding  = errors.New("unsupported content-encoding")
+	ErrMalformedContentEncoding    = errors.New("malformed content-encoding")
+
+	errReaderReleased = errors.New("read from a released request reader")
+)
+
+// ParseError describes why a request was rejected by the parser. Err is one
+// of the Err* values of this package or the headers package, or
+// io.ErrUnexpectedEOF when the connection closed in the middle of a request.
+type ParseError struct {
+	Err error
+	// Offset is the position of the offending byte counted from the
+	// start of the request line
+	Offset int
+	Detail string
+}
+
+func (e *ParseError) Error() string {
+	if e.Detail == "" {
+		return fmt.Sprintf("%v at byte %d", e.Err, e.Offset)
+	}
+	return fmt.Sprintf("%v at byte %d: %s", e.Err, e.Offset, e.Detail)
+}
+
+func (e *ParseError) Unwrap() error {
+	return e.Err
+}
+
+// parseError returns a ParseError for the byte at offset in the data
+// currently being parsed
+func (r *Request) parseError(err error, offset int, format string, args ...any) *ParseError {
+	return &ParseError{
+		Err:    err,
+		Offset: r.offset + offset,
+		Detail: fmt.Sprintf(format, args...),
+	}
+}
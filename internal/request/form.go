@@ -0,0 +1,106 @@
+package request
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/P-H-Pancholi/httpfromtcp/internal/headers"
+)
+
+const formContentType = "application/x-www-form-urlencoded"
+
+// ParseForm fills Form and PostForm. The body is only read for POST, PUT
+// and PATCH requests with an application/x-www-form-urlencoded
+// Content-Type, and at most Limits.MaxFormBytes of it. Values from the body
+// come before those from the query string in Form.
+func (r *Request) ParseForm() error {
+	if r.Form != nil {
+		return nil
+	}
+
+	postForm, err := r.parsePostForm()
+	if err != nil {
+		return err
+	}
+	query, err := ParseQuery(r.RawQuery())
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrMalformedForm, err)
+	}
+
+	r.PostForm = postForm
+	r.Form = Values{}
+	for k, vs := range postForm {
+		r.Form[k] = append(r.Form[k], vs...)
+	}
+	for k, vs := range query {
+		r.Form[k] = append(r.Form[k], vs...)
+	}
+	return nil
+}
+
+func (r *Request) parsePostForm() (Values, error) {
+	switch r.RequestLine.Method {
+	case MethodPost, MethodPut, MethodPatch:
+	default:
+		return Values{}, nil
+	}
+	ct, ok := r.Headers.Get("Content-Type")
+	if !ok {
+		return Values{}, nil
+	}
+	mediaType, _, err := headers.ParseMediaType(ct)
+	if err != nil || mediaType != formContentType {
+		return Values{}, nil
+	}
+
+	data, err := r.readFormBody()
+	if err != nil {
+		return nil, err
+	}
+	v, err := ParseQuery(string(data))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrMalformedForm, err)
+	}
+	return v, nil
+}
+
+// readFormBody reads the body into Body, failing once it grows past
+// Limits.MaxFormBytes
+func (r *Request) readFormBody() ([]byte, error) {
+	max := r.limits.MaxFormBytes
+	if r.body == nil {
+		if max > 0 && len(r.Body) > max {
+			return nil, fmt.Errorf("%w: limit is %d bytes", ErrFormTooLarge, max)
+		}
+		return r.Body, nil
+	}
+
+	var body io.Reader = r.body
+	if max > 0 {
+		body = io.LimitReader(r.body, int64(max)+1)
+	}
+	data, err := io.ReadAll(body)
+	r.Body = append(r.Body, data...)
+	if err != nil {
+		return nil, err
+	}
+	if max > 0 && len(r.Body) > max {
+		return nil, fmt.Errorf("%w: limit is %d bytes", ErrFormTooLarge, max)
+	}
+	r.body = nil
+	return r.Body, nil
+}
+
+// FormValue returns the first value for the key from Form, calling
+// ParseForm first if needed. Parse errors are ignored.
+func (r *Request) FormValue(key string) string {
+	r.ParseForm()
+	return r.Form.Get(key)
+}
+
+// PostFormValue returns the first value for the key from PostForm, calling
+// ParseForm first if needed. Parse errors are ignored.
+func (r *Request) PostFormValue(key string) string {
+	r.ParseForm()
+	return r.PostForm.Get(key)
+}
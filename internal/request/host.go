@@ -0,0 +1,78 @@
+package request
+
+import (
+	"bytes"
+	"net"
+	"strings"
+)
+
+// parseHost checks the Host header once the header section has been read
+// and sets Host and Port. RFC 9112 section 3.2 requires exactly one Host
+// header in HTTP/1.1 requests. The host of an absolute-form or
+// authority-form target takes precedence over the header.
+func (r *Request) parseHost() error {
+	if r.hostCount > 1 {
+		return r.parseError(ErrInvalidHost, 0, "%d Host headers", r.hostCount)
+	}
+	value, ok := r.Headers.Get("Host")
+	if !ok && r.RequestLine.HttpVersion != "1.0" {
+		return r.parseError(ErrMissingHost, 0, "HTTP/%s requests need a Host header", r.RequestLine.HttpVersion)
+	}
+	if ok && value != "" {
+		if _, _, valid := splitHost(value); !valid {
+			return r.parseError(ErrInvalidHost, 0, "%q", value)
+		}
+	}
+	if authority := r.RequestLine.Target.Authority; authority != "" {
+		value = authority
+	}
+	if value == "" {
+		return nil
+	}
+	host, port, valid := splitHost(value)
+	if !valid {
+		return r.parseError(ErrInvalidHost, 0, "%q", value)
+	}
+	r.Host = strings.TrimSuffix(strings.ToLower(host), ".")
+	r.Port = port
+	return nil
+}
+
+// splitHost is splitHostPort that also checks the characters of the host
+func splitHost(hostport string) (host, port string, ok bool) {
+	host, port, ok = splitHostPort(hostport)
+	if !ok {
+		return "", "", false
+	}
+	if strings.HasPrefix(host, "[") {
+		// an IP-literal holds an IPv6 address, "[]" and "[1.2.3.4]" don't
+		addr := host[1 : len(host)-1]
+		if !strings.Contains(addr, ":") || net.ParseIP(addr) == nil {
+			return "", "", false
+		}
+		return host, port, true
+	}
+	for i := 0; i < len(host); i++ {
+		if !isRegNameChar(host[i]) {
+			return "", "", false
+		}
+	}
+	return host, port, true
+}
+
+// isRegNameChar reports whether c may appear in a reg-name, RFC 3986
+// section 3.2.2
+func isRegNameChar(c byte) bool {
+	switch {
+	case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c >= '0' && c <= '9':
+		return true
+	}
+	// unreserved, sub-delims and the '%' of pct-encoded
+	return strings.IndexByte("-._~!$&'()*+,;=%", c) != -1
+}
+
+// isHostLine reports whether a field line is a Host header. Parse has
+// already rejected whitespace before the colon and line folding.
+func isHostLine(line []byte) bool {
+	return len(line) >= 5 && bytes.EqualFold(line[:5], []byte("host:"))
+}
@@ -0,0 +1,52 @@
+package request
+
+import (
+	"bytes"
+)
+
+// Limits bounds how much of a request the parser accepts before giving up.
+// A zero field means no limit.
+type Limits struct {
+	// MaxRequestLineBytes is the longest request line, without the CRLF
+	MaxRequestLineBytes int
+	// MaxHeaderBytes is the size of the whole header section, including
+	// the line endings
+	MaxHeaderBytes int
+	// MaxHeaderCount is the number of header lines
+	MaxHeaderCount int
+	// MaxBodyBytes is the size of the decoded body
+	MaxBodyBytes int
+	// MaxFormBytes is the size of an urlencoded body read by ParseForm
+	MaxFormBytes int
+	// MaxPartBytes is the size of the body of a single multipart part
+	MaxPartBytes int
+	// MaxMultipartBytes is the size of a whole multipart body
+	MaxMultipartBytes int
+	// MaxDecompressedBytes is the size of a body after DecompressBody has
+	// removed its content coding
+	MaxDecompressedBytes int
+}
+
+// DefaultLimits are the limits used by NewReader
+var DefaultLimits = Limits{
+	MaxRequestLineBytes:  8 << 10,
+	MaxHeaderBytes:       64 << 10,
+	MaxHeaderCount:       100,
+	MaxBodyBytes:         10 << 20,
+	MaxFormBytes:         1 << 20,
+	MaxPartBytes:         10 << 20,
+	MaxMultipartBytes:    10 << 20,
+	MaxDecompressedBytes: 10 << 20,
+}
+
+// lineLength returns the length of the line at the start of data without
+// its CRLF. When the end of the line hasn't been read yet the length read
+// so far is returned.
+func lineLength(data []byte) int {
+	idx := bytes.Index(data, []byte(crlf))
+	if idx == -1 {
+		// a trailing CR may be the start of the CRLF
+		return len(bytes.TrimSuffix(data, []byte("\r")))
+	}
+	return idx
+}
@@ -0,0 +1,61 @@
+package request
+
+import "github.com/P-H-Pancholi/httpfromtcp/internal/headers"
+
+// The request methods defined by RFC 9110 section 9 and RFC 5789
+const (
+	MethodGet     = "GET"
+	MethodHead    = "HEAD"
+	MethodPost    = "POST"
+	MethodPut     = "PUT"
+	MethodDelete  = "DELETE"
+	MethodConnect = "CONNECT"
+	MethodOptions = "OPTIONS"
+	MethodTrace   = "TRACE"
+	MethodPatch   = "PATCH"
+)
+
+// StandardMethods lists the Method* constants
+var StandardMethods = []string{
+	MethodGet,
+	MethodHead,
+	MethodPost,
+	MethodPut,
+	MethodDelete,
+	MethodConnect,
+	MethodOptions,
+	MethodTrace,
+	MethodPatch,
+}
+
+// IsStandardMethod reports whether method is one of the Method* constants
+// rather than an extension method
+func IsStandardMethod(method string) bool {
+	switch method {
+	case MethodGet, MethodHead, MethodPost, MethodPut, MethodDelete,
+		MethodConnect, MethodOptions, MethodTrace, MethodPatch:
+		return true
+	}
+	return false
+}
+
+// invalidMethodIndex returns the index of the first byte that makes method
+// invalid, or -1 if it is valid. A method is a token as in RFC 9110 section
+// 9.1. Methods are case-sensitive and every registered one is upper case,
+// so lower case letters are rejected as a mistyped method, and the method
+// has to start with a letter.
+func invalidMethodIndex(method string) int {
+	if method == "" {
+		return 0
+	}
+	if c := method[0]; c < 'A' || c > 'Z' {
+		return 0
+	}
+	for i := 1; i < len(method); i++ {
+		c := method[i]
+		if c >= 'a' && c <= 'z' || !headers.IsTokenChar(c) {
+			return i
+		}
+	}
+	return -1
+}
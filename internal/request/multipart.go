@@ -0,0 +1,386 @@
+package request
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/P-H-Pancholi/httpfromtcp/internal/headers"
+)
+
+const multipartContentType = "multipart/form-data"
+
+// MultipartReader iterates over the parts of a multipart/form-data body as
+// described in RFC 7578, reading them straight from the request body
+type MultipartReader struct {
+	br *bufio.Reader
+	// delim is the CRLF and "--boundary" that starts every part
+	delim []byte
+
+	current    *Part
+	done       bool
+	maxPart    int
+	maxHeaders int
+}
+
+// Part is a single part of a multipart body. Read returns the part's body,
+// which ends at the next boundary.
+type Part struct {
+	Headers headers.Headers
+
+	mr *MultipartReader
+	// size is the number of body bytes read so far
+	size int
+	// limited is false for the preamble, which is skipped without
+	// counting towards the part limit
+	limited bool
+	eof     bool
+	err     error
+
+	name     string
+	filename string
+}
+
+// MultipartReader returns a reader for a multipart/form-data body. The
+// parts are read from BodyReader so the body is streamed when the request
+// was read with ReadRequestHeader.
+func (r *Request) MultipartReader() (*MultipartReader, error) {
+	ct, ok := r.Headers.Get("Content-Type")
+	if !ok {
+		return nil, ErrNotMultipart
+	}
+	mediaType, params, err := headers.ParseMediaType(ct)
+	if err != nil || mediaType != multipartContentType {
+		return nil, ErrNotMultipart
+	}
+	boundary := params["boundary"]
+	if boundary == "" || len(boundary) > 70 {
+		return nil, fmt.Errorf("%w: invalid boundary %q", ErrMalformedMultipart, boundary)
+	}
+
+	var body io.Reader = r.BodyReader()
+	if max := r.limits.MaxMultipartBytes; max > 0 {
+		body = &limitedReader{r: body, n: max, err: ErrMultipartTooLarge}
+	}
+	// the first boundary has no CRLF in front of it, adding one lets it
+	// be found like all the others
+	body = io.MultiReader(strings.NewReader(crlf), body)
+
+	mr := &MultipartReader{
+		br:         bufio.NewReaderSize(body, 4096),
+		delim:      []byte(crlf + "--" + boundary),
+		maxPart:    r.limits.MaxPartBytes,
+		maxHeaders: r.limits.MaxHeaderBytes,
+	}
+	mr.current = &Part{mr: mr}
+	return mr, nil
+}
+
+// NextPart skips the rest of the current part and returns the next one.
+// It returns io.EOF once the closing boundary has been read.
+func (mr *MultipartReader) NextPart() (*Part, error) {
+	if mr.done {
+		return nil, io.EOF
+	}
+	if mr.current != nil {
+		if _, err := io.Copy(io.Discard, mr.current); err != nil {
+			return nil, err
+		}
+		mr.current = nil
+	}
+
+	if _, err := mr.br.Discard(len(mr.delim)); err != nil {
+		return nil, mr.unexpected(err)
+	}
+	// the delimiter is followed by "--" on the closing boundary, or by
+	// optional whitespace and a CRLF
+	if next, _ := mr.br.Peek(2); bytes.Equal(next, []byte("--")) {
+		mr.done = true
+		return nil, io.EOF
+	}
+	line, err := mr.br.ReadSlice('\n')
+	if err != nil {
+		return nil, mr.unexpected(err)
+	}
+	if !bytes.Equal(bytes.TrimLeft(line, " \t"), []byte(crlf)) {
+		return nil, fmt.Errorf("%w: unexpected %q after boundary", ErrMalformedMultipart, line)
+	}
+
+	h, err := mr.readHeaders()
+	if err != nil {
+		return nil, err
+	}
+	p := &Part{
+		Headers: h,
+		mr:      mr,
+		limited: true,
+	}
+	if cd, ok := h.Get("Content-Disposition"); ok {
+		if _, params, err := headers.ParseContentDisposition(cd); err == nil {
+			p.name = params["name"]
+			p.filename = params["filename"]
+		}
+	}
+	mr.current = p
+	return p, nil
+}
+
+func (mr *MultipartReader) readHeaders() (headers.Headers, error) {
+	h := headers.NewHeaders()
+	size := 0
+	for {
+		line, err := mr.br.ReadSlice('\n')
+		if errors.Is(err, bufio.ErrBufferFull) {
+			return nil, fmt.Errorf("%w: part header line too long", ErrMalformedMultipart)
+		}
+		if err != nil {
+			return nil, mr.unexpected(err)
+		}
+		size += len(line)
+		if mr.maxHeaders > 0 && size > mr.maxHeaders {
+			return nil, fmt.Errorf("%w: part headers too large", ErrMalformedMultipart)
+		}
+		n, done, err := h.Parse(line)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrMalformedMultipart, err)
+		}
+		if n == 0 {
+			return nil, fmt.Errorf("%w: part header line not terminated by CRLF", ErrMalformedMultipart)
+		}
+		if done {
+			return h, nil
+		}
+	}
+}
+
+// unexpected turns the end of the body into an error about the missing
+// closing boundary
+func (mr *MultipartReader) unexpected(err error) error {
+	if errors.Is(err, io.EOF) {
+		return fmt.Errorf("%w: %w", ErrMalformedMultipart, io.ErrUnexpectedEOF)
+	}
+	return err
+}
+
+func (p *Part) Read(d []byte) (int, error) {
+	if p.err != nil {
+		return 0, p.err
+	}
+	if p.eof {
+		return 0, io.EOF
+	}
+	n, err := p.read(d)
+	if err != nil && err != io.EOF {
+		p.err = err
+	}
+	return n, err
+}
+
+func (p *Part) read(d []byte) (int, error) {
+	br := p.mr.br
+	delim := p.mr.delim
+
+	// with at least a delimiter's worth buffered, a delimiter that isn't
+	// found can only start in the last len(delim)-1 bytes
+	_, err := br.Peek(len(delim))
+	buf, _ := br.Peek(br.Buffered())
+	if i := bytes.Index(buf, delim); i != -1 {
+		if i == 0 {
+			p.eof = true
+			return 0, io.EOF
+		}
+		buf = buf[:i]
+	} else if err != nil {
+		return 0, p.mr.unexpected(err)
+	} else {
+		buf = buf[:len(buf)-len(delim)+1]
+	}
+
+	n := copy(d, buf)
+	br.Discard(n)
+	p.size += n
+	if p.limited && p.mr.maxPart > 0 && p.size > p.mr.maxPart {
+		return n, fmt.Errorf("%w: limit is %d bytes", ErrPartTooLarge, p.mr.maxPart)
+	}
+	return n, nil
+}
+
+// FormName returns the name parameter of the part's Content-Disposition
+func (p *Part) FormName() string {
+	return p.name
+}
+
+// FileName returns the filename parameter of the part's
+// Content-Disposition, it is empty for parts that aren't file uploads
+func (p *Part) FileName() string {
+	return p.filename
+}
+
+// MultipartForm is a parsed multipart form. Files larger than the memory
+// limit given to ParseMultipartForm are stored in temporary files.
+type MultipartForm struct {
+	Value map[string][]string
+	File  map[string][]*FileHeader
+}
+
+// FileHeader describes an uploaded file of a multipart form
+type FileHeader struct {
+	Filename string
+	Headers  headers.Headers
+	Size     int64
+
+	content []byte
+	tmpfile string
+}
+
+// Open returns the uploaded file's content
+func (fh *FileHeader) Open() (io.ReadCloser, error) {
+	if fh.tmpfile != "" {
+		return os.Open(fh.tmpfile)
+	}
+	return io.NopCloser(bytes.NewReader(fh.content)), nil
+}
+
+// RemoveAll deletes the temporary files of the form
+func (f *MultipartForm) RemoveAll() error {
+	var err error
+	for _, fhs := range f.File {
+		for _, fh := range fhs {
+			if fh.tmpfile == "" {
+				continue
+			}
+			if e := os.Remove(fh.tmpfile); e != nil && !errors.Is(e, os.ErrNotExist) && err == nil {
+				err = e
+			}
+		}
+	}
+	return err
+}
+
+// ParseMultipartForm reads a multipart/form-data body into MultipartForm.
+// Up to maxMemory bytes of values and files are kept in memory, the rest
+// of the files spill to temporary files that are removed by
+// MultipartForm.RemoveAll. The values are also added to Form and PostForm.
+func (r *Request) ParseMultipartForm(maxMemory int64) error {
+	if r.MultipartForm != nil {
+		return nil
+	}
+	if err := r.ParseForm(); err != nil {
+		return err
+	}
+	mr, err := r.MultipartReader()
+	if err != nil {
+		return err
+	}
+
+	form := &MultipartForm{
+		Value: map[string][]string{},
+		File:  map[string][]*FileHeader{},
+	}
+	for {
+		p, err := mr.NextPart()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			form.RemoveAll()
+			return err
+		}
+		name := p.FormName()
+		if name == "" {
+			continue
+		}
+
+		var buf bytes.Buffer
+		n, err := io.CopyN(&buf, p, maxMemory+1)
+		if err != nil && err != io.EOF {
+			form.RemoveAll()
+			return err
+		}
+		if p.FileName() == "" {
+			if n > maxMemory {
+				form.RemoveAll()
+				return fmt.Errorf("%w: form values use more than %d bytes of memory", ErrMultipartTooLarge, maxMemory)
+			}
+			maxMemory -= n
+			form.Value[name] = append(form.Value[name], buf.String())
+			continue
+		}
+
+		fh := &FileHeader{
+			Filename: p.FileName(),
+			Headers:  p.Headers,
+		}
+		if n > maxMemory {
+			// keep the file on disk and the memory for other parts
+			fh.Size, err = spill(fh, &buf, p)
+			if err != nil {
+				form.RemoveAll()
+				return err
+			}
+		} else {
+			maxMemory -= n
+			fh.content = buf.Bytes()
+			fh.Size = n
+		}
+		form.File[name] = append(form.File[name], fh)
+	}
+
+	for k, vs := range form.Value {
+		r.Form[k] = append(r.Form[k], vs...)
+		r.PostForm[k] = append(r.PostForm[k], vs...)
+	}
+	r.MultipartForm = form
+	return nil
+}
+
+// spill writes the buffered start of a file and the rest of the part to a
+// temporary file
+func spill(fh *FileHeader, buf *bytes.Buffer, p *Part) (int64, error) {
+	f, err := os.CreateTemp("", "multipart-")
+	if err != nil {
+		return 0, err
+	}
+	fh.tmpfile = f.Name()
+	n, err := io.Copy(f, io.MultiReader(buf, p))
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(fh.tmpfile)
+		fh.tmpfile = ""
+		return 0, err
+	}
+	return n, nil
+}
+
+// limitedReader fails with err once more than n bytes have been read. The
+// bytes past the limit aren't returned, so a reader that buffers ahead
+// can't parse them before it sees the error.
+type limitedReader struct {
+	r   io.Reader
+	n   int
+	err error
+}
+
+func (l *limitedReader) Read(p []byte) (int, error) {
+	if l.n < 0 {
+		return 0, fmt.Errorf("%w: limit exceeded", l.err)
+	}
+	// one byte more than allowed is enough to tell the limit was exceeded
+	if len(p) > l.n+1 {
+		p = p[:l.n+1]
+	}
+	n, err := l.r.Read(p)
+	if n > l.n {
+		n = l.n
+		l.n = -1
+		return n, fmt.Errorf("%w: limit exceeded", l.err)
+	}
+	l.n -= n
+	return n, err
+}
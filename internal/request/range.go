@@ -0,0 +1,64 @@
+package request
+
+import (
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/P-H-Pancholi/httpfromtcp/internal/headers"
+)
+
+// maxRanges is the number of ranges served from one request, more are
+// likely an attempt to make the server do a lot of small reads
+const maxRanges = 100
+
+// Ranges returns the byte ranges a GET request asks for from a
+// representation of size bytes whose current validators are etag and
+// modTime. Either validator may be left empty. It returns nil, meaning the
+// whole representation is sent with 200, when there is no usable Range
+// header or the If-Range condition doesn't hold. Ranges that all start
+// past the end return headers.ErrRangeNotSatisfiable.
+func (r *Request) Ranges(size int64, etag string, modTime time.Time) ([]headers.ByteRange, error) {
+	if r.RequestLine.Method != MethodGet {
+		return nil, nil
+	}
+	value, ok := r.Headers.Get("Range")
+	if !ok {
+		return nil, nil
+	}
+	if ifRange, ok := r.Headers.Get("If-Range"); ok && !ifRangeMatches(ifRange, etag, modTime) {
+		return nil, nil
+	}
+	ranges, err := headers.ParseRange(value, size)
+	if errors.Is(err, headers.ErrInvalidRange) {
+		// RFC 9110 section 14.2 lets a server ignore a malformed Range
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	// ranges that add up to more than the whole are served as the whole
+	var total int64
+	for _, br := range ranges {
+		total += br.Length
+	}
+	if len(ranges) > maxRanges || total > size {
+		return nil, nil
+	}
+	return ranges, nil
+}
+
+// ifRangeMatches evaluates an If-Range value as in RFC 9110 section 13.1.5.
+// An entity-tag has to match etag with the strong comparison, a date has
+// to be exactly modTime.
+func ifRangeMatches(ifRange, etag string, modTime time.Time) bool {
+	ifRange = strings.TrimSpace(ifRange)
+	if strings.HasPrefix(ifRange, `"`) || strings.HasPrefix(ifRange, "W/") {
+		return etag != "" && !strings.HasPrefix(etag, "W/") && ifRange == etag
+	}
+	t, err := headers.ParseTime(ifRange)
+	if err != nil || modTime.IsZero() {
+		return false
+	}
+	return t.Equal(modTime.Truncate(time.Second))
+}
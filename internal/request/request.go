@@ -2,24 +2,42 @@ package request
 
 import (
 	"bytes"
+	"context"
+	"crypto/tls"
 	"errors"
 	"fmt"
 	"io"
+	"net"
 	"strconv"
 	"strings"
-	"unicode"
+	"sync"
 
 	"github.com/P-H-Pancholi/httpfromtcp/internal/headers"
 )
 
 type State int64
 
-const bufferSize = 8
+// bufferSize is the initial size of a Reader's buffer, it is grown for
+// requests whose request line or headers don't fit
+const bufferSize = 4096
+
+// bufferPool holds buffers of bufferSize released by Readers
+var bufferPool = sync.Pool{
+	New: func() any {
+		buf := make([]byte, bufferSize)
+		return &buf
+	},
+}
 
 const (
 	Initialized State = iota
 	parseHeaders
 	parseBody
+	parseFixedBody
+	parseChunkSize
+	parseChunkData
+	parseChunkDataEnd
+	parseChunkTrailer
 	Done
 )
 
@@ -28,85 +46,291 @@ type Request struct {
 	Headers     headers.Headers
 	State       State
 	Body        []byte
+	// Trailers holds the declared trailer fields of a chunked body. It is
+	// empty until the whole body has been read and nil for other bodies.
+	Trailers headers.Headers
+
+	// Form holds the query parameters and the urlencoded body values,
+	// PostForm only the body values. Both are nil until ParseForm is called.
+	Form     Values
+	PostForm Values
+	// MultipartForm is set by ParseMultipartForm
+	MultipartForm *MultipartForm
+
+	// RemoteAddr and LocalAddr are the addresses of the connection the
+	// request was read from, they are set by the server
+	RemoteAddr net.Addr
+	LocalAddr  net.Addr
+	// ConnID identifies the connection among those accepted by the server
+	ConnID uint64
+	// Seq is the position of the request on its connection, starting at 1
+	Seq int
+	// TLS is the state of the TLS connection the request was read from,
+	// it is nil for plain connections
+	TLS *tls.ConnectionState
+
+	// Host is the lower case host the request is for, taken from the
+	// request target or the Host header. An IPv6 address keeps its
+	// brackets. Port is the port that came with it, if any.
+	Host string
+	Port string
+
+	ctx context.Context
+
+	// body streams the rest of the body from the connection, it is nil
+	// once the whole body has been read into Body
+	body io.ReadCloser
+	// onBodyRead is called before the body is first read
+	onBodyRead func()
+	// pending holds decoded body bytes not yet handed to the body reader
+	pending []byte
+	// bodyRead is the number of body bytes decoded so far
+	bodyRead int
+	// contentLength is the length of a body framed by Content-Length
+	contentLength int
+	// chunkRemaining is the number of bytes left in the chunk being read
+	chunkRemaining int
+
+	limits      Limits
+	strict      bool
+	headerBytes int
+	headerCount int
+	hostCount   int
+	// offset is the number of bytes of the request parsed so far
+	offset int
 }
 
 type RequestLine struct {
 	HttpVersion   string
 	RequestTarget string
 	Method        string
+	// Target is RequestTarget parsed into its parts
+	Target Target
+}
+
+// Path returns the normalised, percent-decoded path of the request target.
+// It is empty for the authority-form and asterisk-form.
+func (r *Request) Path() string {
+	return r.RequestLine.Target.Path
+}
+
+// RawQuery returns the encoded query of the request target without the '?'
+func (r *Request) RawQuery() string {
+	return r.RequestLine.Target.RawQuery
+}
+
+// Query returns the decoded query parameters. Malformed pairs are skipped,
+// use ParseQuery on RawQuery to get an error for them instead.
+func (r *Request) Query() Values {
+	v, _ := ParseQuery(r.RequestLine.Target.RawQuery)
+	return v
+}
+
+// KeepAlive reports whether the connection may be reused for another
+// request once this one has been answered. HTTP/1.1 connections persist
+// unless the client sends Connection: close, HTTP/1.0 ones only when it
+// sends Connection: keep-alive.
+func (r *Request) KeepAlive() bool {
+	if r.Headers.HasToken("Connection", "close") {
+		return false
+	}
+	if r.RequestLine.HttpVersion == "1.0" {
+		return r.Headers.HasToken("Connection", "keep-alive")
+	}
+	return true
+}
+
+// Reader reads successive requests from a single connection. Bytes read
+// past the end of one request are kept and parsed as the start of the next.
+type Reader struct {
+	// Limits applies to every request read after it is set
+	Limits Limits
+	// StrictPaths rejects request targets whose path holds an encoded
+	// slash or NUL instead of decoding them
+	StrictPaths bool
+
+	reader io.Reader
+	// buf[start:end] holds the data read from the connection that hasn't
+	// been parsed yet
+	buf   []byte
+	start int
+	end   int
+	err   error
+}
+
+// NewReader returns a Reader with a buffer taken from a pool, Release
+// hands it back once the connection is done
+func NewReader(reader io.Reader) *Reader {
+	return &Reader{
+		Limits: DefaultLimits,
+		reader: reader,
+		buf:    *bufferPool.Get().(*[]byte),
+	}
+}
+
+// Release returns the Reader's buffer to the pool. The Reader and the body
+// of the last request read from it can't be used afterwards.
+func (rr *Reader) Release() {
+	if len(rr.buf) == bufferSize {
+		buf := rr.buf
+		bufferPool.Put(&buf)
+	}
+	rr.buf = nil
+	rr.start, rr.end = 0, 0
+	if rr.err == nil {
+		rr.err = errReaderReleased
+	}
 }
 
 func RequestFromReader(reader io.Reader) (*Request, error) {
-	buf := make([]byte, bufferSize, bufferSize)
+	rr := NewReader(reader)
+	defer rr.Release()
+	return rr.ReadRequest()
+}
 
-	readToIndex := 0
+// ReadRequest reads the next request from the connection, including the
+// whole body. It returns io.EOF if the connection is closed cleanly before
+// a new request starts.
+func (rr *Reader) ReadRequest() (*Request, error) {
+	r, err := rr.ReadRequestHeader()
+	if err != nil {
+		return nil, err
+	}
+	if _, err := r.ReadBody(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// ReadRequestHeader reads the request line and headers of the next request.
+// The body is left on the connection and streamed through BodyReader, it
+// has to be consumed or closed before the next request is read.
+func (rr *Reader) ReadRequestHeader() (*Request, error) {
 	r := &Request{
 		State:   Initialized,
 		Headers: make(headers.Headers),
+		limits:  rr.Limits,
+		strict:  rr.StrictPaths,
 	}
 
-	for r.State != Done {
-		if readToIndex >= cap(buf) {
-			newbuf := make([]byte, len(buf)*2)
-			copy(newbuf, buf)
-			buf = newbuf
+	for r.State == Initialized || r.State == parseHeaders {
+		if err := rr.advance(r); err != nil {
+			return nil, err
 		}
+	}
+	r.body = &body{reader: rr, req: r}
+	return r, nil
+}
 
-		// read into the buffer
-		n, err := reader.Read(buf[readToIndex:])
-		if err != nil {
-			if errors.Is(err, io.EOF) {
-				if r.State != Done {
-					return nil, fmt.Errorf("error: malformed request")
-				}
-				break
+// advance parses the buffered data into the request, reading more from the
+// connection when the buffer doesn't hold enough to make progress
+func (rr *Reader) advance(r *Request) error {
+	// parse from the buffer first, it may already hold bytes left over
+	// from the previous request
+	prevState := r.State
+	bytesRead, err := r.parse(rr.buf[rr.start:rr.end])
+	if err != nil {
+		return err
+	}
+	rr.start += bytesRead
+	if rr.start == rr.end {
+		rr.start, rr.end = 0, 0
+	}
+	if bytesRead > 0 || r.State != prevState {
+		return nil
+	}
+
+	if rr.err != nil {
+		if errors.Is(rr.err, io.EOF) {
+			if r.State == Initialized && rr.start == rr.end {
+				return io.EOF
 			}
-			return nil, err
+			return r.parseError(io.ErrUnexpectedEOF, rr.end-rr.start, "connection closed")
 		}
-		readToIndex += n
+		return rr.err
+	}
+	rr.fill()
+	return nil
+}
 
-		// parse from the buffer
-		bytesRead, err := r.parse(buf[:readToIndex])
-		if err != nil {
-			return nil, err
+// fill reads more data from the connection into the buffer. The unparsed
+// data is moved to the front of the buffer to make room, the buffer is
+// only grown when it is full of it. A read error is kept and reported
+// once the buffered data has been parsed.
+func (rr *Reader) fill() {
+	if rr.end == len(rr.buf) {
+		if rr.start > 0 {
+			rr.end = copy(rr.buf, rr.buf[rr.start:rr.end])
+			rr.start = 0
+		} else {
+			newbuf := make([]byte, len(rr.buf)*2)
+			copy(newbuf, rr.buf)
+			rr.buf = newbuf
 		}
+	}
 
-		copy(buf, buf[bytesRead:])
-		readToIndex -= bytesRead
+	n, err := rr.reader.Read(rr.buf[rr.end:])
+	rr.end += n
+	if err != nil {
+		rr.err = err
 	}
-	return r, nil
 }
 
-func parseRequestLine(data []byte) (*RequestLine, int, error) {
+func parseRequestLine(data []byte, strictPaths bool) (*RequestLine, int, error) {
 	idx := bytes.Index(data, []byte("\r\n"))
 	if idx == -1 {
 		return &RequestLine{}, 0, nil
 	}
 
 	reqLine := string(data[:idx])
-	splitedReqLine := strings.Split(reqLine, " ")
+	method, rest, ok1 := strings.Cut(reqLine, " ")
+	requestTarget, version, ok2 := strings.Cut(rest, " ")
 
-	if len(splitedReqLine) != 3 {
-		return &RequestLine{}, 0, fmt.Errorf("request line does not have all sections")
+	if !ok1 || !ok2 || strings.Contains(version, " ") {
+		return &RequestLine{}, 0, &ParseError{
+			Err:    ErrMalformedRequestLine,
+			Detail: "request line does not have all sections",
+		}
 	}
 
-	for _, s := range splitedReqLine[0] {
-		if unicode.IsLetter(s) && !unicode.IsUpper(s) {
-			return &RequestLine{}, 0, fmt.Errorf("request method is invalid")
+	if i := invalidMethodIndex(method); i != -1 {
+		return &RequestLine{}, 0, &ParseError{
+			Err:    ErrInvalidMethod,
+			Offset: i,
+			Detail: fmt.Sprintf("%q", method),
 		}
 	}
 	var r RequestLine
 
-	r.Method = splitedReqLine[0]
+	r.Method = method
 
-	r.RequestTarget = splitedReqLine[1]
+	r.RequestTarget = requestTarget
+	target, perr := parseTarget(r.Method, r.RequestTarget, strictPaths)
+	if perr != nil {
+		perr.Offset += len(r.Method) + 1
+		return &RequestLine{}, 0, perr
+	}
+	r.Target = target
 
-	httpVersion := strings.Split(splitedReqLine[2], "/")
+	versionOffset := len(method) + len(requestTarget) + 2
+	// HTTP-version = "HTTP" "/" DIGIT "." DIGIT
+	if len(version) != 8 || !strings.HasPrefix(version, "HTTP/") ||
+		!isDigit(version[5]) || version[6] != '.' || !isDigit(version[7]) {
+		return &RequestLine{}, 0, &ParseError{
+			Err:    ErrMalformedRequestLine,
+			Offset: versionOffset,
+			Detail: fmt.Sprintf("invalid http version %q", version),
+		}
+	}
 
-	if httpVersion[1] != "1.1" && httpVersion[0] != "HTTP" {
-		return &RequestLine{}, 0, fmt.Errorf("http version is invalid")
+	if version != "HTTP/1.1" && version != "HTTP/1.0" {
+		return &RequestLine{}, 0, &ParseError{
+			Err:    ErrUnsupportedVersion,
+			Offset: versionOffset,
+			Detail: fmt.Sprintf("%q", version),
+		}
 	}
-	r.HttpVersion = httpVersion[1]
+	r.HttpVersion = version[5:]
 
 	return &r, idx + 2, nil
 }
@@ -114,12 +338,14 @@ func parseRequestLine(data []byte) (*RequestLine, int, error) {
 func (r *Request) parse(data []byte) (int, error) {
 	numOfBytesParsed := 0
 	for r.State != Done {
+		prevState := r.State
 		n, err := r.parseSingle(data[numOfBytesParsed:])
 		if err != nil {
 			return 0, err
 		}
 		numOfBytesParsed += n
-		if n == 0 {
+		r.offset += n
+		if n == 0 && r.State == prevState {
 			break
 		}
 
@@ -130,7 +356,10 @@ func (r *Request) parse(data []byte) (int, error) {
 func (r *Request) parseSingle(data []byte) (int, error) {
 	switch r.State {
 	case Initialized:
-		reqLine, n, err := parseRequestLine(data)
+		if max := r.limits.MaxRequestLineBytes; max > 0 && lineLength(data) > max {
+			return 0, r.parseError(ErrRequestLineTooLong, max, "limit is %d bytes", max)
+		}
+		reqLine, n, err := parseRequestLine(data, r.strict)
 
 		if err != nil {
 			return 0, err
@@ -144,35 +373,130 @@ func (r *Request) parseSingle(data []byte) (int, error) {
 		r.State = parseHeaders
 		return n, nil
 	case parseHeaders:
+		if max := r.limits.MaxHeaderBytes; max > 0 && r.headerBytes+lineLength(data) > max {
+			return 0, r.parseError(ErrHeadersTooLarge, max-r.headerBytes, "limit is %d bytes", max)
+		}
+		if err := r.checkObsFold(data); err != nil {
+			return 0, err
+		}
 		n, done, err := r.Headers.Parse(data)
 		if err != nil {
+			var herr *headers.ParseError
+			if errors.As(err, &herr) {
+				return 0, r.parseError(herr.Err, herr.Offset, "%s", herr.Detail)
+			}
 			return 0, err
 		}
+		r.headerBytes += n
 		if done {
+			if err := r.parseHost(); err != nil {
+				return 0, err
+			}
 			r.State = parseBody
+		} else if n > 0 {
+			if isHostLine(data) {
+				r.hostCount++
+			}
+			r.headerCount++
+			if max := r.limits.MaxHeaderCount; max > 0 && r.headerCount > max {
+				return 0, r.parseError(ErrTooManyHeaders, 0, "limit is %d headers", max)
+			}
 		}
 		return n, nil
 	case parseBody:
-		s, exists := r.Headers.Get("Content-Length")
-		if !exists {
+		// RFC 9112 section 6.3, a request with both framings could be
+		// read differently by a proxy in front of the server
+		te, hasTE := r.Headers.Get("Transfer-Encoding")
+		cl, hasCL := r.Headers.Get("Content-Length")
+		if hasTE && hasCL {
+			return 0, r.parseError(ErrConflictingLength, 0, "content-length %q and transfer-encoding %q", cl, te)
+		}
+		if hasTE {
+			// RFC 9112 section 6.1, an HTTP/1.0 recipient may not know
+			// chunked, so the framing can't be trusted
+			if r.RequestLine.HttpVersion == "1.0" {
+				return 0, r.parseError(ErrInvalidTransferEncoding, 0, "transfer-encoding in an HTTP/1.0 request")
+			}
+			if err := checkTransferEncoding(te); err != nil {
+				return 0, r.parseError(err, 0, "%q", te)
+			}
+			r.Trailers = headers.NewHeaders()
+			r.State = parseChunkSize
+			return 0, nil
+		}
+		if !hasCL {
 			r.State = Done
 			return 0, nil
 		}
-		r.Body = append(r.Body, data...)
-		n, err := strconv.Atoi(s)
+		contentLength, err := parseContentLength(cl)
 		if err != nil {
-			return 0, err
+			return 0, r.parseError(ErrInvalidContentLength, 0, "%v", err)
 		}
-		if len(r.Body) > n {
-			return 0, fmt.Errorf("error: body length greater than content-length")
+		if max := r.limits.MaxBodyBytes; max > 0 && contentLength > max {
+			return 0, r.parseError(ErrBodyTooLarge, 0, "limit is %d bytes", max)
 		}
-		if len(r.Body) == n {
+		// the length is kept as the header may be changed while the
+		// body is streamed
+		r.contentLength = contentLength
+		r.State = parseFixedBody
+		return 0, nil
+	case parseFixedBody:
+		// only consume this request's body, anything after it belongs
+		// to the next request on the connection
+		n := min(r.contentLength-r.bodyRead, len(data))
+		r.appendBody(data[:n])
+		if r.bodyRead == r.contentLength {
 			r.State = Done
 		}
-		return len(data), nil
+		return n, nil
+	case parseChunkSize, parseChunkData, parseChunkDataEnd, parseChunkTrailer:
+		return r.parseChunked(data)
 	case Done:
 		return 0, fmt.Errorf("error: trying to read data in done state")
 	default:
 		return 0, fmt.Errorf("error: unknown state")
 	}
 }
+
+// parseContentLength parses a Content-Length value. Repeated fields are
+// joined into a list by Headers.Set, they are only accepted when all of
+// them are the same length.
+func parseContentLength(s string) (int, error) {
+	length := -1
+	for _, v := range strings.Split(s, ",") {
+		v = strings.TrimSpace(v)
+		if v == "" {
+			return 0, fmt.Errorf("empty value in %q", s)
+		}
+		// Atoi would also take a sign
+		for i := 0; i < len(v); i++ {
+			if !isDigit(v[i]) {
+				return 0, fmt.Errorf("%q is not a number", v)
+			}
+		}
+		n, err := strconv.Atoi(v)
+		if err != nil {
+			return 0, fmt.Errorf("%q is out of range", v)
+		}
+		if length != -1 && n != length {
+			return 0, fmt.Errorf("differing values %q", s)
+		}
+		length = n
+	}
+	return length, nil
+}
+
+// checkObsFold rejects a field line that starts with whitespace. RFC 9112
+// section 5.2 calls this obsolete line folding, a recipient that joins the
+// line with the previous field would see different headers than one that
+// doesn't.
+func (r *Request) checkObsFold(data []byte) error {
+	if len(data) > 0 && (data[0] == ' ' || data[0] == '\t') {
+		return r.parseError(ErrObsoleteFold, 0, "field line starts with whitespace")
+	}
+	return nil
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
@@ -1,10 +1,18 @@
 package request
 
 import (
+	"bytes"
+	"compress/gzip"
+	"compress/zlib"
+	"context"
+	"encoding/base64"
 	"io"
+	"strconv"
 	"strings"
 	"testing"
+	"time"
 
+	"github.com/P-H-Pancholi/httpfromtcp/internal/headers"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
@@ -151,3 +159,1561 @@ func TestBodyFromReader(t *testing.T) {
 	assert.Empty(t, r.Body)
 
 }
+
+func TestChunkedBodyFromReader(t *testing.T) {
+	reader := &ChunkReader{
+		data: "POST /submit HTTP/1.1\r\n" +
+			"Host: localhost:42069\r\n" +
+			"Transfer-Encoding: chunked\r\n" +
+			"\r\n" +
+			"5\r\n" +
+			"hello\r\n" +
+			"7;name=value\r\n" +
+			" world!\r\n" +
+			"0\r\n" +
+			"\r\n",
+		numBytesPerRead: 3,
+	}
+	r, err := RequestFromReader(reader)
+	require.NoError(t, err)
+	require.NotNil(t, r)
+	assert.Equal(t, "hello world!", string(r.Body))
+
+	// Test: chunk size in upper case hex with trailer fields
+	reader = &ChunkReader{
+		data: "POST /submit HTTP/1.1\r\n" +
+			"Host: localhost:42069\r\n" +
+			"Transfer-Encoding: chunked\r\n" +
+			"\r\n" +
+			"1A\r\n" +
+			"abcdefghijklmnopqrstuvwxyz\r\n" +
+			"0\r\n" +
+			"X-Checksum: abc\r\n" +
+			"\r\n",
+		numBytesPerRead: 1,
+	}
+	r, err = RequestFromReader(reader)
+	require.NoError(t, err)
+	assert.Equal(t, "abcdefghijklmnopqrstuvwxyz", string(r.Body))
+
+	// Test: empty chunked body
+	r, err = RequestFromReader(strings.NewReader("POST /submit HTTP/1.1\r\n" +
+		"Host: localhost:42069\r\n" +
+		"Transfer-Encoding: chunked\r\n" +
+		"\r\n" +
+		"0\r\n" +
+		"\r\n"))
+	require.NoError(t, err)
+	assert.Empty(t, r.Body)
+
+	// Test: invalid chunk size
+	_, err = RequestFromReader(strings.NewReader("POST /submit HTTP/1.1\r\n" +
+		"Host: localhost:42069\r\n" +
+		"Transfer-Encoding: chunked\r\n" +
+		"\r\n" +
+		"-5\r\n" +
+		"hello\r\n" +
+		"0\r\n" +
+		"\r\n"))
+	require.Error(t, err)
+
+	// Test: chunk data longer than chunk size
+	_, err = RequestFromReader(strings.NewReader("POST /submit HTTP/1.1\r\n" +
+		"Host: localhost:42069\r\n" +
+		"Transfer-Encoding: chunked\r\n" +
+		"\r\n" +
+		"3\r\n" +
+		"hello\r\n" +
+		"0\r\n" +
+		"\r\n"))
+	require.Error(t, err)
+
+	// Test: missing last chunk
+	_, err = RequestFromReader(strings.NewReader("POST /submit HTTP/1.1\r\n" +
+		"Host: localhost:42069\r\n" +
+		"Transfer-Encoding: chunked\r\n" +
+		"\r\n" +
+		"5\r\n" +
+		"hello\r\n"))
+	require.Error(t, err)
+
+	// Test: chunked is not the final coding
+	_, err = RequestFromReader(strings.NewReader("POST /submit HTTP/1.1\r\n" +
+		"Host: localhost:42069\r\n" +
+		"Transfer-Encoding: chunked, gzip\r\n" +
+		"\r\n" +
+		"0\r\n" +
+		"\r\n"))
+	require.Error(t, err)
+}
+
+func TestPipelinedRequestsFromReader(t *testing.T) {
+	reader := NewReader(&ChunkReader{
+		data: "POST /first HTTP/1.1\r\n" +
+			"Host: localhost:42069\r\n" +
+			"Content-Length: 5\r\n" +
+			"\r\n" +
+			"hello" +
+			"GET /second HTTP/1.1\r\n" +
+			"Host: localhost:42069\r\n" +
+			"\r\n" +
+			"POST /third HTTP/1.1\r\n" +
+			"Host: localhost:42069\r\n" +
+			"Transfer-Encoding: chunked\r\n" +
+			"Connection: close\r\n" +
+			"\r\n" +
+			"3\r\n" +
+			"abc\r\n" +
+			"0\r\n" +
+			"\r\n",
+		numBytesPerRead: 7,
+	})
+
+	r, err := reader.ReadRequest()
+	require.NoError(t, err)
+	assert.Equal(t, "/first", r.RequestLine.RequestTarget)
+	assert.Equal(t, "hello", string(r.Body))
+	assert.True(t, r.KeepAlive())
+
+	r, err = reader.ReadRequest()
+	require.NoError(t, err)
+	assert.Equal(t, "/second", r.RequestLine.RequestTarget)
+	assert.Empty(t, r.Body)
+
+	r, err = reader.ReadRequest()
+	require.NoError(t, err)
+	assert.Equal(t, "/third", r.RequestLine.RequestTarget)
+	assert.Equal(t, "abc", string(r.Body))
+	assert.False(t, r.KeepAlive())
+
+	_, err = reader.ReadRequest()
+	assert.ErrorIs(t, err, io.EOF)
+
+	// Test: connection closed in the middle of a request
+	reader = NewReader(strings.NewReader("GET / HTTP/1.1\r\n" +
+		"Host: localhost:42069\r\n" +
+		"\r\n" +
+		"GET / HTTP/1.1\r\n"))
+	_, err = reader.ReadRequest()
+	require.NoError(t, err)
+	_, err = reader.ReadRequest()
+	require.Error(t, err)
+	assert.NotErrorIs(t, err, io.EOF)
+}
+
+func TestStreamingBodyFromReader(t *testing.T) {
+	reader := NewReader(&ChunkReader{
+		data: "POST /upload HTTP/1.1\r\n" +
+			"Host: localhost:42069\r\n" +
+			"Transfer-Encoding: chunked\r\n" +
+			"\r\n" +
+			"5\r\n" +
+			"hello\r\n" +
+			"7\r\n" +
+			" world!\r\n" +
+			"0\r\n" +
+			"\r\n" +
+			"POST /next HTTP/1.1\r\n" +
+			"Host: localhost:42069\r\n" +
+			"Content-Length: 10\r\n" +
+			"\r\n" +
+			"0123456789" +
+			"GET /last HTTP/1.1\r\n" +
+			"Host: localhost:42069\r\n" +
+			"\r\n",
+		numBytesPerRead: 4,
+	})
+
+	r, err := reader.ReadRequestHeader()
+	require.NoError(t, err)
+	assert.Equal(t, "/upload", r.RequestLine.RequestTarget)
+	assert.Empty(t, r.Body)
+	data, err := io.ReadAll(r.BodyReader())
+	require.NoError(t, err)
+	assert.Equal(t, "hello world!", string(data))
+	require.NoError(t, r.BodyReader().Close())
+
+	// Test: closing a partly read body skips the rest of it
+	r, err = reader.ReadRequestHeader()
+	require.NoError(t, err)
+	assert.Equal(t, "/next", r.RequestLine.RequestTarget)
+	p := make([]byte, 4)
+	n, err := io.ReadFull(r.BodyReader(), p)
+	require.NoError(t, err)
+	assert.Equal(t, "0123", string(p[:n]))
+	require.NoError(t, r.BodyReader().Close())
+	_, err = r.BodyReader().Read(p)
+	assert.Error(t, err)
+
+	r, err = reader.ReadRequestHeader()
+	require.NoError(t, err)
+	assert.Equal(t, "/last", r.RequestLine.RequestTarget)
+	body, err := r.ReadBody()
+	require.NoError(t, err)
+	assert.Empty(t, body)
+
+	// Test: connection closed before the body is complete
+	reader = NewReader(strings.NewReader("POST /upload HTTP/1.1\r\n" +
+		"Host: localhost:42069\r\n" +
+		"Content-Length: 20\r\n" +
+		"\r\n" +
+		"partial content"))
+	r, err = reader.ReadRequestHeader()
+	require.NoError(t, err)
+	_, err = io.ReadAll(r.BodyReader())
+	assert.ErrorIs(t, err, io.ErrUnexpectedEOF)
+
+	// Test: ReadBody buffers a streamed body
+	reader = NewReader(strings.NewReader("POST /upload HTTP/1.1\r\n" +
+		"Host: localhost:42069\r\n" +
+		"Content-Length: 5\r\n" +
+		"\r\n" +
+		"hello"))
+	r, err = reader.ReadRequestHeader()
+	require.NoError(t, err)
+	body, err = r.ReadBody()
+	require.NoError(t, err)
+	assert.Equal(t, "hello", string(body))
+	assert.Equal(t, "hello", string(r.Body))
+	data, err = io.ReadAll(r.BodyReader())
+	require.NoError(t, err)
+	assert.Equal(t, "hello", string(data))
+}
+
+func TestLimitsFromReader(t *testing.T) {
+	limits := Limits{
+		MaxRequestLineBytes: 25,
+		MaxHeaderBytes:      60,
+		MaxHeaderCount:      3,
+		MaxBodyBytes:        10,
+	}
+	read := func(data string) (*Request, error) {
+		reader := NewReader(&ChunkReader{data: data, numBytesPerRead: 3})
+		reader.Limits = limits
+		return reader.ReadRequest()
+	}
+
+	r, err := read("GET /exactly/25b HTTP/1.1\r\n" +
+		"Host: localhost:42069\r\n" +
+		"Content-Length: 10\r\n" +
+		"\r\n" +
+		"0123456789")
+	require.NoError(t, err)
+	assert.Equal(t, "0123456789", string(r.Body))
+
+	_, err = read("GET /exactly/26bs HTTP/1.1\r\n" +
+		"Host: localhost:42069\r\n" +
+		"\r\n")
+	assert.ErrorIs(t, err, ErrRequestLineTooLong)
+
+	// Test: the request line limit applies before the line is complete
+	_, err = read("GET /" + strings.Repeat("a", 100))
+	assert.ErrorIs(t, err, ErrRequestLineTooLong)
+
+	_, err = read("GET / HTTP/1.1\r\n" +
+		"Host: localhost:42069\r\n" +
+		"X-Long: " + strings.Repeat("a", 40) + "\r\n" +
+		"\r\n")
+	assert.ErrorIs(t, err, ErrHeadersTooLarge)
+
+	_, err = read("GET / HTTP/1.1\r\n" +
+		"Host: localhost:42069\r\n" +
+		"A: 1\r\n" +
+		"B: 2\r\n" +
+		"C: 3\r\n" +
+		"\r\n")
+	assert.ErrorIs(t, err, ErrTooManyHeaders)
+
+	_, err = read("POST / HTTP/1.1\r\n" +
+		"Host: localhost:42069\r\n" +
+		"Content-Length: 11\r\n" +
+		"\r\n" +
+		"01234567890")
+	assert.ErrorIs(t, err, ErrBodyTooLarge)
+
+	_, err = read("POST / HTTP/1.1\r\n" +
+		"Host: localhost:42069\r\n" +
+		"Transfer-Encoding: chunked\r\n" +
+		"\r\n" +
+		"6\r\n" +
+		"012345\r\n" +
+		"5\r\n" +
+		"67890\r\n" +
+		"0\r\n" +
+		"\r\n")
+	assert.ErrorIs(t, err, ErrBodyTooLarge)
+
+	// Test: zero limits are unlimited
+	reader := NewReader(strings.NewReader("GET /" + strings.Repeat("a", 10000) + " HTTP/1.1\r\n" +
+		"Host: localhost:42069\r\n" +
+		"\r\n"))
+	reader.Limits = Limits{}
+	_, err = reader.ReadRequest()
+	require.NoError(t, err)
+}
+
+func TestParseErrors(t *testing.T) {
+	tests := []struct {
+		name   string
+		data   string
+		err    error
+		offset int
+	}{
+		{
+			name:   "missing section",
+			data:   "GET /\r\n\r\n",
+			err:    ErrMalformedRequestLine,
+			offset: 0,
+		},
+		{
+			name:   "lower case method",
+			data:   "GeT / HTTP/1.1\r\n\r\n",
+			err:    ErrInvalidMethod,
+			offset: 1,
+		},
+		{
+			name:   "version without slash",
+			data:   "GET / HTTP1.1\r\n\r\n",
+			err:    ErrMalformedRequestLine,
+			offset: 6,
+		},
+		{
+			name:   "invalid header name",
+			data:   "GET / HTTP/1.1\r\nHost: localhost\r\nH©st: localhost\r\n\r\n",
+			err:    headers.ErrInvalidHeaderName,
+			offset: 34,
+		},
+		{
+			name:   "header without colon",
+			data:   "GET / HTTP/1.1\r\nHost localhost\r\n\r\n",
+			err:    headers.ErrMalformedHeader,
+			offset: 30,
+		},
+		{
+			name:   "invalid content-length",
+			data:   "POST / HTTP/1.1\r\nHost: a\r\nContent-Length: five\r\n\r\nhello",
+			err:    ErrInvalidContentLength,
+			offset: 50,
+		},
+		{
+			name:   "invalid chunk size",
+			data:   "POST / HTTP/1.1\r\nHost: a\r\nTransfer-Encoding: chunked\r\n\r\n5\r\nhello\r\nzz\r\n",
+			err:    ErrMalformedChunk,
+			offset: 66,
+		},
+		{
+			name:   "unterminated chunk",
+			data:   "POST / HTTP/1.1\r\nHost: a\r\nTransfer-Encoding: chunked\r\n\r\n5\r\nhello!\r\n",
+			err:    ErrMalformedChunk,
+			offset: 64,
+		},
+		{
+			name:   "connection closed",
+			data:   "GET / HTTP/1.1\r\nHost: loc",
+			err:    io.ErrUnexpectedEOF,
+			offset: 25,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := RequestFromReader(&ChunkReader{data: tt.data, numBytesPerRead: 5})
+			require.ErrorIs(t, err, tt.err)
+			var perr *ParseError
+			require.ErrorAs(t, err, &perr)
+			assert.Equal(t, tt.offset, perr.Offset)
+		})
+	}
+}
+
+func TestRequestTarget(t *testing.T) {
+	tests := []struct {
+		name   string
+		line   string
+		target Target
+	}{
+		{
+			name: "origin-form",
+			line: "GET /video?x=1&y=two%20words HTTP/1.1",
+			target: Target{
+				Form:     OriginForm,
+				RawPath:  "/video",
+				Path:     "/video",
+				RawQuery: "x=1&y=two%20words",
+			},
+		},
+		{
+			name: "origin-form with escapes",
+			line: "GET /caf%C3%A9/a+b HTTP/1.1",
+			target: Target{
+				Form:    OriginForm,
+				RawPath: "/caf%C3%A9/a+b",
+				Path:    "/café/a+b",
+			},
+		},
+		{
+			name: "absolute-form",
+			line: "GET HTTP://www.example.org:8080/pub/WWW/TheProject.html?q=1 HTTP/1.1",
+			target: Target{
+				Form:      AbsoluteForm,
+				Scheme:    "http",
+				Authority: "www.example.org:8080",
+				RawPath:   "/pub/WWW/TheProject.html",
+				Path:      "/pub/WWW/TheProject.html",
+				RawQuery:  "q=1",
+			},
+		},
+		{
+			name: "absolute-form without path",
+			line: "GET http://www.example.org?q=1 HTTP/1.1",
+			target: Target{
+				Form:      AbsoluteForm,
+				Scheme:    "http",
+				Authority: "www.example.org",
+				RawPath:   "/",
+				Path:      "/",
+				RawQuery:  "q=1",
+			},
+		},
+		{
+			name: "authority-form",
+			line: "CONNECT www.example.com:80 HTTP/1.1",
+			target: Target{
+				Form:      AuthorityForm,
+				Authority: "www.example.com:80",
+			},
+		},
+		{
+			name: "authority-form with ipv6",
+			line: "CONNECT [::1]:443 HTTP/1.1",
+			target: Target{
+				Form:      AuthorityForm,
+				Authority: "[::1]:443",
+			},
+		},
+		{
+			name:   "asterisk-form",
+			line:   "OPTIONS * HTTP/1.1",
+			target: Target{Form: AsteriskForm},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r, err := RequestFromReader(strings.NewReader(tt.line + "\r\nHost: localhost\r\n\r\n"))
+			require.NoError(t, err)
+			assert.Equal(t, tt.target, r.RequestLine.Target)
+			assert.Equal(t, tt.target.Path, r.Path())
+			assert.Equal(t, tt.target.RawQuery, r.RawQuery())
+		})
+	}
+
+	invalid := []string{
+		"GET /a\x01b HTTP/1.1",
+		"GET /a\tb HTTP/1.1",
+		"GET /page#section HTTP/1.1",
+		"GET /bad%zzescape HTTP/1.1",
+		"GET relative/path HTTP/1.1",
+		"GET * HTTP/1.1",
+		"CONNECT www.example.com HTTP/1.1",
+		"CONNECT /path HTTP/1.1",
+		"GET http:///path HTTP/1.1",
+	}
+	for _, line := range invalid {
+		_, err := RequestFromReader(strings.NewReader(line + "\r\nHost: localhost\r\n\r\n"))
+		assert.ErrorIs(t, err, ErrInvalidTarget, line)
+	}
+
+	// Test: the offset points at the offending byte of the target
+	_, err := RequestFromReader(strings.NewReader("GET /a\x7fb HTTP/1.1\r\nHost: localhost\r\n\r\n"))
+	var perr *ParseError
+	require.ErrorAs(t, err, &perr)
+	assert.Equal(t, 6, perr.Offset)
+}
+
+func TestQuery(t *testing.T) {
+	r, err := RequestFromReader(strings.NewReader("GET /search?q=go+lang&tag=a&tag=b&empty=&flag&&x=%41 HTTP/1.1\r\n" +
+		"Host: localhost\r\n\r\n"))
+	require.NoError(t, err)
+	q := r.Query()
+	assert.Equal(t, "go lang", q.Get("q"))
+	assert.Equal(t, []string{"a", "b"}, q["tag"])
+	assert.True(t, q.Has("empty"))
+	assert.Equal(t, "", q.Get("empty"))
+	assert.True(t, q.Has("flag"))
+	assert.Equal(t, "A", q.Get("x"))
+	assert.False(t, q.Has("missing"))
+
+	v, err := ParseQuery("a=1&b=%zz&c=3")
+	assert.Error(t, err)
+	assert.Equal(t, Values{"a": {"1"}, "c": {"3"}}, v)
+
+	// Test: a malformed query doesn't fail the request, only ParseForm
+	r, err = RequestFromReader(strings.NewReader("GET /x?q=50%&a=1 HTTP/1.1\r\nHost: localhost\r\n\r\n"))
+	require.NoError(t, err)
+	assert.Equal(t, "q=50%&a=1", r.RawQuery())
+	assert.Equal(t, Values{"a": {"1"}}, r.Query())
+	assert.ErrorIs(t, r.ParseForm(), ErrMalformedForm)
+}
+
+func TestNormalizedPath(t *testing.T) {
+	paths := map[string]string{
+		"/":                  "/",
+		"/a/b":               "/a/b",
+		"/a/b/":              "/a/b/",
+		"/a//b":              "/a/b",
+		"/a/./b":             "/a/b",
+		"/a/../b":            "/b",
+		"/a/%2e%2e/b":        "/b",
+		"/a/%2E%2e/%2e/b":    "/b",
+		"/a/b/..":            "/a/",
+		"/a/b/.":             "/a/b/",
+		"/../../etc/passwd":  "/etc/passwd",
+		"/a%2f..%2fsecret":   "/secret",
+		"/admin/%2e%2e%2fok": "/ok",
+		"/.%2e/x":            "/x",
+	}
+	for raw, want := range paths {
+		r, err := RequestFromReader(strings.NewReader("GET " + raw + " HTTP/1.1\r\nHost: localhost\r\n\r\n"))
+		require.NoError(t, err, raw)
+		assert.Equal(t, want, r.Path(), raw)
+		assert.Equal(t, raw, r.RequestLine.Target.RawPath)
+	}
+
+	strict := func(target string) (*Request, error) {
+		reader := NewReader(strings.NewReader("GET " + target + " HTTP/1.1\r\nHost: localhost\r\n\r\n"))
+		reader.StrictPaths = true
+		return reader.ReadRequest()
+	}
+	r, err := strict("/a/%2e%2e/b?next=%2F")
+	require.NoError(t, err)
+	assert.Equal(t, "/b", r.Path())
+
+	_, err = strict("/a%2fb")
+	assert.ErrorIs(t, err, ErrInvalidTarget)
+	var perr *ParseError
+	require.ErrorAs(t, err, &perr)
+	assert.Equal(t, 6, perr.Offset)
+
+	_, err = strict("/a%2Fb")
+	assert.ErrorIs(t, err, ErrInvalidTarget)
+
+	_, err = strict("/file%00.txt")
+	assert.ErrorIs(t, err, ErrInvalidTarget)
+}
+
+func TestParseForm(t *testing.T) {
+	r, err := RequestFromReader(strings.NewReader("POST /signup?source=ad&name=query HTTP/1.1\r\n" +
+		"Host: localhost\r\n" +
+		"Content-Type: application/x-www-form-urlencoded; charset=utf-8\r\n" +
+		"Content-Length: 45\r\n" +
+		"\r\n" +
+		"name=Jane+Doe&langs=go&langs=c%2B%2B&agree=on"))
+	require.NoError(t, err)
+	require.NoError(t, r.ParseForm())
+	assert.Equal(t, []string{"Jane Doe", "query"}, r.Form["name"])
+	assert.Equal(t, []string{"go", "c++"}, r.Form["langs"])
+	assert.Equal(t, "ad", r.FormValue("source"))
+	assert.Equal(t, "Jane Doe", r.PostFormValue("name"))
+	assert.False(t, r.PostForm.Has("source"))
+
+	// Test: the body is left alone for other content types
+	r, err = RequestFromReader(strings.NewReader("POST /upload?a=1 HTTP/1.1\r\n" +
+		"Host: localhost\r\n" +
+		"Content-Type: text/plain\r\n" +
+		"Content-Length: 3\r\n" +
+		"\r\n" +
+		"b=2"))
+	require.NoError(t, err)
+	require.NoError(t, r.ParseForm())
+	assert.Equal(t, Values{"a": {"1"}}, r.Form)
+	assert.Empty(t, r.PostForm)
+
+	// Test: GET only uses the query string
+	r, err = RequestFromReader(strings.NewReader("GET /search?q=x HTTP/1.1\r\n" +
+		"Host: localhost\r\n" +
+		"Content-Type: application/x-www-form-urlencoded\r\n" +
+		"\r\n"))
+	require.NoError(t, err)
+	assert.Equal(t, "x", r.FormValue("q"))
+
+	// Test: malformed encoding
+	r, err = RequestFromReader(strings.NewReader("POST / HTTP/1.1\r\n" +
+		"Host: localhost\r\n" +
+		"Content-Type: application/x-www-form-urlencoded\r\n" +
+		"Content-Length: 7\r\n" +
+		"\r\n" +
+		"a=%zz&b"))
+	require.NoError(t, err)
+	assert.ErrorIs(t, r.ParseForm(), ErrMalformedForm)
+
+	// Test: streamed body larger than the form limit
+	reader := NewReader(strings.NewReader("POST / HTTP/1.1\r\n" +
+		"Host: localhost\r\n" +
+		"Content-Type: application/x-www-form-urlencoded\r\n" +
+		"Content-Length: 20\r\n" +
+		"\r\n" +
+		"a=0123456789&b=01234"))
+	reader.Limits.MaxFormBytes = 16
+	r, err = reader.ReadRequestHeader()
+	require.NoError(t, err)
+	assert.ErrorIs(t, r.ParseForm(), ErrFormTooLarge)
+
+	// Test: streamed body within the limit stays available in Body
+	reader = NewReader(strings.NewReader("PUT / HTTP/1.1\r\n" +
+		"Host: localhost\r\n" +
+		"Content-Type: application/x-www-form-urlencoded\r\n" +
+		"Content-Length: 7\r\n" +
+		"\r\n" +
+		"a=1&b=2"))
+	r, err = reader.ReadRequestHeader()
+	require.NoError(t, err)
+	require.NoError(t, r.ParseForm())
+	assert.Equal(t, "2", r.PostFormValue("b"))
+	assert.Equal(t, "a=1&b=2", string(r.Body))
+}
+
+func multipartRequest(body string) string {
+	return "POST /upload?from=query HTTP/1.1\r\n" +
+		"Host: localhost\r\n" +
+		"Content-Type: multipart/form-data; boundary=\"xYzZY\"\r\n" +
+		"Content-Length: " + strconv.Itoa(len(body)) + "\r\n" +
+		"\r\n" +
+		body
+}
+
+const multipartBody = "preamble to ignore\r\n" +
+	"--xYzZY\r\n" +
+	"Content-Disposition: form-data; name=\"title\"\r\n" +
+	"\r\n" +
+	"Holiday\r\n" +
+	"--xYzZY  \r\n" +
+	"Content-Disposition: form-data; name=\"photo\"; filename=\"beach.txt\"\r\n" +
+	"Content-Type: text/plain\r\n" +
+	"\r\n" +
+	"line one\r\n" +
+	"line two with --xYzZ almost a boundary\r\n" +
+	"--xYzZY\r\n" +
+	"Content-Disposition: form-data; name=\"title\"\r\n" +
+	"\r\n" +
+	"\r\n" +
+	"--xYzZY--\r\n" +
+	"epilogue to ignore"
+
+func TestMultipartReader(t *testing.T) {
+	reader := NewReader(&ChunkReader{data: multipartRequest(multipartBody), numBytesPerRead: 7})
+	r, err := reader.ReadRequestHeader()
+	require.NoError(t, err)
+
+	mr, err := r.MultipartReader()
+	require.NoError(t, err)
+
+	p, err := mr.NextPart()
+	require.NoError(t, err)
+	assert.Equal(t, "title", p.FormName())
+	assert.Equal(t, "", p.FileName())
+	data, err := io.ReadAll(p)
+	require.NoError(t, err)
+	assert.Equal(t, "Holiday", string(data))
+
+	p, err = mr.NextPart()
+	require.NoError(t, err)
+	assert.Equal(t, "photo", p.FormName())
+	assert.Equal(t, "beach.txt", p.FileName())
+	ct, _ := p.Headers.Get("Content-Type")
+	assert.Equal(t, "text/plain", ct)
+	// only read the start, NextPart skips the rest
+	buf := make([]byte, 4)
+	_, err = io.ReadFull(p, buf)
+	require.NoError(t, err)
+	assert.Equal(t, "line", string(buf))
+
+	p, err = mr.NextPart()
+	require.NoError(t, err)
+	data, err = io.ReadAll(p)
+	require.NoError(t, err)
+	assert.Equal(t, "", string(data))
+
+	_, err = mr.NextPart()
+	assert.ErrorIs(t, err, io.EOF)
+
+	// Test: not a multipart body
+	r, err = RequestFromReader(strings.NewReader("POST / HTTP/1.1\r\nHost: localhost\r\nContent-Type: text/plain\r\n\r\n"))
+	require.NoError(t, err)
+	_, err = r.MultipartReader()
+	assert.ErrorIs(t, err, ErrNotMultipart)
+
+	// Test: missing closing boundary
+	r, err = RequestFromReader(strings.NewReader(multipartRequest("--xYzZY\r\n" +
+		"Content-Disposition: form-data; name=\"a\"\r\n" +
+		"\r\n" +
+		"never ends")))
+	require.NoError(t, err)
+	mr, err = r.MultipartReader()
+	require.NoError(t, err)
+	p, err = mr.NextPart()
+	require.NoError(t, err)
+	_, err = io.ReadAll(p)
+	assert.ErrorIs(t, err, ErrMalformedMultipart)
+	assert.ErrorIs(t, err, io.ErrUnexpectedEOF)
+}
+
+func TestMultipartLimits(t *testing.T) {
+	reader := NewReader(strings.NewReader(multipartRequest(multipartBody)))
+	reader.Limits.MaxPartBytes = 16
+	r, err := reader.ReadRequestHeader()
+	require.NoError(t, err)
+	mr, err := r.MultipartReader()
+	require.NoError(t, err)
+	_, err = mr.NextPart()
+	require.NoError(t, err)
+	p, err := mr.NextPart()
+	require.NoError(t, err)
+	_, err = io.ReadAll(p)
+	assert.ErrorIs(t, err, ErrPartTooLarge)
+
+	reader = NewReader(strings.NewReader(multipartRequest(multipartBody)))
+	reader.Limits.MaxMultipartBytes = 100
+	r, err = reader.ReadRequestHeader()
+	require.NoError(t, err)
+	assert.ErrorIs(t, r.ParseMultipartForm(1<<20), ErrMultipartTooLarge)
+}
+
+func TestMultipartLimitReadAhead(t *testing.T) {
+	// one read returns the whole body, the closing boundary lies past the
+	// limit and must not be parsed before the limit error is seen
+	data := multipartRequest(multipartBody)
+	reader := NewReader(&ChunkReader{data: data, numBytesPerRead: len(data)})
+	reader.Limits.MaxMultipartBytes = strings.Index(multipartBody, "--xYzZY--")
+	r, err := reader.ReadRequestHeader()
+	require.NoError(t, err)
+	mr, err := r.MultipartReader()
+	require.NoError(t, err)
+	for {
+		var p *Part
+		p, err = mr.NextPart()
+		if err != nil {
+			break
+		}
+		if _, err = io.ReadAll(p); err != nil {
+			break
+		}
+	}
+	assert.ErrorIs(t, err, ErrMultipartTooLarge)
+}
+
+func TestParseMultipartForm(t *testing.T) {
+	r, err := RequestFromReader(strings.NewReader(multipartRequest(multipartBody)))
+	require.NoError(t, err)
+	require.NoError(t, r.ParseMultipartForm(1<<20))
+	form := r.MultipartForm
+	assert.Equal(t, []string{"Holiday", ""}, form.Value["title"])
+	assert.Equal(t, []string{"Holiday", ""}, r.PostForm["title"])
+	assert.Equal(t, "query", r.FormValue("from"))
+
+	require.Len(t, form.File["photo"], 1)
+	fh := form.File["photo"][0]
+	assert.Equal(t, "beach.txt", fh.Filename)
+	assert.Equal(t, int64(48), fh.Size)
+	assert.Empty(t, fh.tmpfile)
+	f, err := fh.Open()
+	require.NoError(t, err)
+	data, err := io.ReadAll(f)
+	require.NoError(t, err)
+	assert.Equal(t, "line one\r\nline two with --xYzZ almost a boundary", string(data))
+
+	// Test: files beyond the memory limit are stored on disk
+	r, err = RequestFromReader(strings.NewReader(multipartRequest(multipartBody)))
+	require.NoError(t, err)
+	require.NoError(t, r.ParseMultipartForm(10))
+	fh = r.MultipartForm.File["photo"][0]
+	require.NotEmpty(t, fh.tmpfile)
+	f, err = fh.Open()
+	require.NoError(t, err)
+	data, err = io.ReadAll(f)
+	require.NoError(t, err)
+	f.Close()
+	assert.Equal(t, "line one\r\nline two with --xYzZ almost a boundary", string(data))
+	require.NoError(t, r.MultipartForm.RemoveAll())
+	_, err = fh.Open()
+	assert.Error(t, err)
+}
+
+func TestCookies(t *testing.T) {
+	r, err := RequestFromReader(strings.NewReader("GET / HTTP/1.1\r\n" +
+		"Host: localhost\r\n" +
+		"Cookie: session=abc123; theme=dark\r\n" +
+		"Cookie: lang=en\r\n" +
+		"\r\n"))
+	require.NoError(t, err)
+	assert.Len(t, r.Cookies(), 3)
+	c, err := r.Cookie("lang")
+	require.NoError(t, err)
+	assert.Equal(t, "en", c.Value)
+	_, err = r.Cookie("missing")
+	assert.ErrorIs(t, err, ErrNoCookie)
+}
+
+func TestExpectsContinue(t *testing.T) {
+	reader := NewReader(strings.NewReader("POST / HTTP/1.1\r\n" +
+		"Host: localhost\r\n" +
+		"Expect: 100-Continue\r\n" +
+		"Content-Length: 5\r\n" +
+		"\r\n" +
+		"hello"))
+	r, err := reader.ReadRequestHeader()
+	require.NoError(t, err)
+	expect, err := r.ExpectsContinue()
+	require.NoError(t, err)
+	assert.True(t, expect)
+
+	calls := 0
+	r.OnBodyRead(func() { calls++ })
+	body, err := r.ReadBody()
+	require.NoError(t, err)
+	assert.Equal(t, "hello", string(body))
+	assert.Equal(t, 1, calls)
+
+	r, err = RequestFromReader(strings.NewReader("POST / HTTP/1.1\r\nHost: localhost\r\nExpect: something-else\r\n\r\n"))
+	require.NoError(t, err)
+	_, err = r.ExpectsContinue()
+	assert.ErrorIs(t, err, ErrUnsupportedExpectation)
+
+	// Test: closing the body without reading it doesn't count as a read
+	reader = NewReader(strings.NewReader("POST / HTTP/1.1\r\nHost: localhost\r\nContent-Length: 5\r\n\r\nhello"))
+	r, err = reader.ReadRequestHeader()
+	require.NoError(t, err)
+	r.OnBodyRead(func() { calls++ })
+	require.NoError(t, r.BodyReader().Close())
+	assert.Equal(t, 1, calls)
+}
+
+func TestHttpVersion(t *testing.T) {
+	r, err := RequestFromReader(strings.NewReader("GET / HTTP/1.0\r\n\r\n"))
+	require.NoError(t, err)
+	assert.Equal(t, "1.0", r.RequestLine.HttpVersion)
+	assert.False(t, r.KeepAlive())
+
+	r, err = RequestFromReader(strings.NewReader("GET / HTTP/1.0\r\nConnection: Keep-Alive\r\n\r\n"))
+	require.NoError(t, err)
+	assert.True(t, r.KeepAlive())
+
+	r, err = RequestFromReader(strings.NewReader("GET / HTTP/1.1\r\nHost: localhost\r\n\r\n"))
+	require.NoError(t, err)
+	assert.True(t, r.KeepAlive())
+
+	for _, version := range []string{"FOO/1.1", "http/1.1", "HTTP/1.1.1", "HTTP/11", "HTTP/a.b", "HTTP/1.", "HTTP 1.1"} {
+		_, err := RequestFromReader(strings.NewReader("GET / " + version + "\r\n\r\n"))
+		assert.ErrorIs(t, err, ErrMalformedRequestLine, version)
+	}
+	for _, version := range []string{"HTTP/2.0", "HTTP/0.9", "HTTP/1.2", "HTTP/3.0"} {
+		_, err := RequestFromReader(strings.NewReader("GET / " + version + "\r\n\r\n"))
+		assert.ErrorIs(t, err, ErrUnsupportedVersion, version)
+	}
+}
+
+func TestContext(t *testing.T) {
+	r, err := RequestFromReader(strings.NewReader("GET / HTTP/1.1\r\nHost: localhost\r\n\r\n"))
+	require.NoError(t, err)
+	assert.Equal(t, context.Background(), r.Context())
+
+	// Test: WithContext returns a copy and leaves the original alone
+	type key struct{}
+	ctx := context.WithValue(context.Background(), key{}, "value")
+	r2 := r.WithContext(ctx)
+	assert.Equal(t, "value", r2.Context().Value(key{}))
+	assert.Equal(t, context.Background(), r.Context())
+	assert.Equal(t, r.RequestLine, r2.RequestLine)
+
+	assert.Panics(t, func() { r.WithContext(nil) })
+}
+
+func TestTrailers(t *testing.T) {
+	reader := &ChunkReader{
+		data: "POST /submit HTTP/1.1\r\n" +
+			"Host: localhost:42069\r\n" +
+			"Transfer-Encoding: chunked\r\n" +
+			"Trailer: X-Checksum, X-Count\r\n" +
+			"\r\n" +
+			"5\r\n" +
+			"hello\r\n" +
+			"0\r\n" +
+			"X-Checksum: abc\r\n" +
+			"X-Count: 5\r\n" +
+			"X-Undeclared: dropped\r\n" +
+			"\r\n",
+		numBytesPerRead: 3,
+	}
+	r, err := NewReader(reader).ReadRequestHeader()
+	require.NoError(t, err)
+	assert.Empty(t, r.Trailers)
+
+	// Test: trailers are set once the body has been read
+	body, err := io.ReadAll(r.BodyReader())
+	require.NoError(t, err)
+	assert.Equal(t, "hello", string(body))
+	assert.Equal(t, headers.Headers{"x-checksum": "abc", "x-count": "5"}, r.Trailers)
+
+	// Test: no trailers for Content-Length bodies
+	r, err = RequestFromReader(strings.NewReader("POST / HTTP/1.1\r\n" +
+		"Host: localhost\r\n" +
+		"Content-Length: 2\r\n" +
+		"\r\n" +
+		"hi"))
+	require.NoError(t, err)
+	assert.Nil(t, r.Trailers)
+
+	// Test: forbidden trailer fields are rejected even when declared
+	for _, name := range []string{"Content-Length", "Host", "Transfer-Encoding", "Authorization"} {
+		_, err = RequestFromReader(strings.NewReader("POST / HTTP/1.1\r\n" +
+			"Host: localhost\r\n" +
+			"Transfer-Encoding: chunked\r\n" +
+			"Trailer: " + name + "\r\n" +
+			"\r\n" +
+			"0\r\n" +
+			name + ": 1\r\n" +
+			"\r\n"))
+		assert.ErrorIs(t, err, ErrInvalidTrailer, name)
+	}
+
+	// Test: malformed trailer line
+	_, err = RequestFromReader(strings.NewReader("POST / HTTP/1.1\r\n" +
+		"Host: localhost\r\n" +
+		"Transfer-Encoding: chunked\r\n" +
+		"\r\n" +
+		"0\r\n" +
+		"no colon\r\n" +
+		"\r\n"))
+	assert.ErrorIs(t, err, headers.ErrMalformedHeader)
+}
+
+func TestContentLengthWithTransferEncoding(t *testing.T) {
+	_, err := RequestFromReader(strings.NewReader("POST / HTTP/1.1\r\n" +
+		"Host: localhost\r\n" +
+		"Content-Length: 5\r\n" +
+		"Transfer-Encoding: chunked\r\n" +
+		"\r\n" +
+		"0\r\n" +
+		"\r\n"))
+	assert.ErrorIs(t, err, ErrConflictingLength)
+
+	// Test: the order of the fields doesn't matter
+	_, err = RequestFromReader(strings.NewReader("POST / HTTP/1.1\r\n" +
+		"Host: localhost\r\n" +
+		"Transfer-Encoding: chunked\r\n" +
+		"Content-Length: 0\r\n" +
+		"\r\n" +
+		"0\r\n" +
+		"\r\n"))
+	assert.ErrorIs(t, err, ErrConflictingLength)
+}
+
+func TestDuplicateContentLength(t *testing.T) {
+	// Test: identical values are the same length
+	r, err := RequestFromReader(strings.NewReader("POST / HTTP/1.1\r\n" +
+		"Host: localhost\r\n" +
+		"Content-Length: 5\r\n" +
+		"Content-Length: 5\r\n" +
+		"\r\n" +
+		"hello"))
+	require.NoError(t, err)
+	assert.Equal(t, "hello", string(r.Body))
+
+	r, err = RequestFromReader(strings.NewReader("POST / HTTP/1.1\r\n" +
+		"Host: localhost\r\n" +
+		"Content-Length: 5, 5\r\n" +
+		"\r\n" +
+		"hello"))
+	require.NoError(t, err)
+	assert.Equal(t, "hello", string(r.Body))
+
+	// Test: differing values
+	_, err = RequestFromReader(strings.NewReader("POST / HTTP/1.1\r\n" +
+		"Host: localhost\r\n" +
+		"Content-Length: 5\r\n" +
+		"Content-Length: 6\r\n" +
+		"\r\n" +
+		"hello!"))
+	assert.ErrorIs(t, err, ErrInvalidContentLength)
+	assert.ErrorContains(t, err, `"5, 6"`)
+}
+
+func TestInvalidContentLength(t *testing.T) {
+	for _, v := range []string{"-5", "+5", "5a", "0x5", "", "5,", " , 5", "99999999999999999999999"} {
+		_, err := RequestFromReader(strings.NewReader("POST / HTTP/1.1\r\n" +
+			"Host: localhost\r\n" +
+			"Content-Length: " + v + "\r\n" +
+			"\r\n" +
+			"hello"))
+		assert.ErrorIs(t, err, ErrInvalidContentLength, v)
+	}
+}
+
+func TestUnknownTransferCoding(t *testing.T) {
+	for _, te := range []string{"gzip", "gzip, chunked", "chunked, gzip", "identity"} {
+		_, err := RequestFromReader(strings.NewReader("POST / HTTP/1.1\r\n" +
+			"Host: localhost\r\n" +
+			"Transfer-Encoding: " + te + "\r\n" +
+			"\r\n" +
+			"0\r\n" +
+			"\r\n"))
+		assert.ErrorIs(t, err, ErrUnsupportedTransferEncoding, te)
+	}
+
+	// Test: chunked has to be applied exactly once
+	for _, te := range []string{"chunked, chunked", "chunked,", ""} {
+		_, err := RequestFromReader(strings.NewReader("POST / HTTP/1.1\r\n" +
+			"Host: localhost\r\n" +
+			"Transfer-Encoding: " + te + "\r\n" +
+			"\r\n" +
+			"0\r\n" +
+			"\r\n"))
+		assert.ErrorIs(t, err, ErrInvalidTransferEncoding, te)
+	}
+
+	// Test: HTTP/1.0 has no transfer codings, even with keep-alive
+	_, err := RequestFromReader(strings.NewReader("POST / HTTP/1.0\r\n" +
+		"Connection: keep-alive\r\n" +
+		"Transfer-Encoding: chunked\r\n" +
+		"\r\n" +
+		"0\r\n" +
+		"\r\n"))
+	assert.ErrorIs(t, err, ErrInvalidTransferEncoding)
+
+	// Test: codings are case-insensitive
+	r, err := RequestFromReader(strings.NewReader("POST / HTTP/1.1\r\n" +
+		"Host: localhost\r\n" +
+		"Transfer-Encoding: Chunked\r\n" +
+		"\r\n" +
+		"2\r\n" +
+		"hi\r\n" +
+		"0\r\n" +
+		"\r\n"))
+	require.NoError(t, err)
+	assert.Equal(t, "hi", string(r.Body))
+}
+
+func TestInvalidFieldValue(t *testing.T) {
+	for _, value := range []string{"foo\rbar", "foo\x00bar", "foo\nbar"} {
+		_, err := RequestFromReader(strings.NewReader("GET / HTTP/1.1\r\n" +
+			"Host: localhost\r\n" +
+			"X-A: " + value + "\r\n" +
+			"\r\n"))
+		require.ErrorIs(t, err, headers.ErrInvalidHeaderValue, "%q", value)
+		var perr *ParseError
+		require.ErrorAs(t, err, &perr)
+		assert.Equal(t, 41, perr.Offset)
+	}
+
+	// Test: a bare CR in a trailer field
+	_, err := RequestFromReader(strings.NewReader("POST / HTTP/1.1\r\n" +
+		"Host: localhost\r\n" +
+		"Transfer-Encoding: chunked\r\n" +
+		"Trailer: X-A\r\n" +
+		"\r\n" +
+		"0\r\n" +
+		"X-A: foo\rContent-Length: 5\r\n" +
+		"\r\n"))
+	assert.ErrorIs(t, err, headers.ErrInvalidHeaderValue)
+}
+
+func TestObsFold(t *testing.T) {
+	_, err := RequestFromReader(strings.NewReader("GET / HTTP/1.1\r\n" +
+		"Host: localhost\r\n" +
+		"X-Folded: first\r\n" +
+		" second\r\n" +
+		"\r\n"))
+	require.ErrorIs(t, err, ErrObsoleteFold)
+	var perr *ParseError
+	require.ErrorAs(t, err, &perr)
+	assert.Equal(t, 50, perr.Offset)
+
+	// Test: a folded line that looks like a header of its own
+	_, err = RequestFromReader(strings.NewReader("GET / HTTP/1.1\r\n" +
+		"Host: localhost\r\n" +
+		"\tContent-Length: 5\r\n" +
+		"\r\n" +
+		"hello"))
+	assert.ErrorIs(t, err, ErrObsoleteFold)
+
+	// Test: whitespace before the first field line
+	_, err = RequestFromReader(strings.NewReader("GET / HTTP/1.1\r\n" +
+		" Host: localhost\r\n" +
+		"\r\n"))
+	assert.ErrorIs(t, err, ErrObsoleteFold)
+
+	// Test: folded trailer field
+	_, err = RequestFromReader(strings.NewReader("POST / HTTP/1.1\r\n" +
+		"Host: localhost\r\n" +
+		"Transfer-Encoding: chunked\r\n" +
+		"Trailer: X-Checksum\r\n" +
+		"\r\n" +
+		"0\r\n" +
+		"X-Checksum: abc\r\n" +
+		" def\r\n" +
+		"\r\n"))
+	assert.ErrorIs(t, err, ErrObsoleteFold)
+}
+
+func TestWrite(t *testing.T) {
+	r := &Request{
+		RequestLine: RequestLine{
+			Method:        "POST",
+			RequestTarget: "/submit?a=1",
+			HttpVersion:   "1.1",
+		},
+		Headers: headers.Headers{
+			"host":         "localhost",
+			"content-type": "text/plain",
+			"accept":       "*/*",
+		},
+		Body: []byte("hello"),
+	}
+	var buf strings.Builder
+	require.NoError(t, r.Write(&buf))
+	assert.Equal(t, "POST /submit?a=1 HTTP/1.1\r\n"+
+		"accept: */*\r\n"+
+		"content-length: 5\r\n"+
+		"content-type: text/plain\r\n"+
+		"host: localhost\r\n"+
+		"\r\n"+
+		"hello", buf.String())
+	_, ok := r.Headers.Get("Content-Length")
+	assert.False(t, ok, "headers of the request are left alone")
+
+	// Test: the written request parses back into the same request
+	r2, err := RequestFromReader(strings.NewReader(buf.String()))
+	require.NoError(t, err)
+	assert.Equal(t, r.RequestLine.Method, r2.RequestLine.Method)
+	assert.Equal(t, r.RequestLine.RequestTarget, r2.RequestLine.RequestTarget)
+	assert.Equal(t, "1", r2.Query().Get("a"))
+	assert.Equal(t, "text/plain", r2.Headers["content-type"])
+	assert.Equal(t, r.Body, r2.Body)
+
+	// Test: a wrong Content-Length is replaced
+	r.Headers["content-length"] = "42"
+	buf.Reset()
+	require.NoError(t, r.Write(&buf))
+	assert.Contains(t, buf.String(), "content-length: 5\r\n")
+
+	// Test: GET without a body has no Content-Length
+	buf.Reset()
+	require.NoError(t, (&Request{
+		RequestLine: RequestLine{Method: "GET", RequestTarget: "/"},
+		Headers:     headers.Headers{"host": "localhost"},
+	}).Write(&buf))
+	assert.Equal(t, "GET / HTTP/1.1\r\nhost: localhost\r\n\r\n", buf.String())
+}
+
+func TestWriteChunked(t *testing.T) {
+	data := "POST /upload HTTP/1.1\r\n" +
+		"Host: localhost\r\n" +
+		"Transfer-Encoding: chunked\r\n" +
+		"Trailer: X-Checksum\r\n" +
+		"\r\n" +
+		"5\r\n" +
+		"hello\r\n" +
+		"6\r\n" +
+		" world\r\n" +
+		"0\r\n" +
+		"X-Checksum: abc\r\n" +
+		"\r\n"
+
+	// Test: a streamed request is forwarded chunk by chunk
+	r, err := NewReader(strings.NewReader(data)).ReadRequestHeader()
+	require.NoError(t, err)
+	var buf strings.Builder
+	require.NoError(t, r.Write(&buf))
+	// chunk sizes depend on how the body was read
+	assert.True(t, strings.HasPrefix(buf.String(), "POST /upload HTTP/1.1\r\n"+
+		"host: localhost\r\n"+
+		"trailer: X-Checksum\r\n"+
+		"transfer-encoding: chunked\r\n"+
+		"\r\n"), buf.String())
+	assert.True(t, strings.HasSuffix(buf.String(), "\r\n0\r\nx-checksum: abc\r\n\r\n"), buf.String())
+
+	r2, err := RequestFromReader(strings.NewReader(buf.String()))
+	require.NoError(t, err)
+	assert.Equal(t, "hello world", string(r2.Body))
+	assert.Equal(t, headers.Headers{"x-checksum": "abc"}, r2.Trailers)
+
+	// Test: unsupported codings can't be written
+	r = &Request{
+		RequestLine: RequestLine{Method: "POST", RequestTarget: "/"},
+		Headers:     headers.Headers{"transfer-encoding": "gzip"},
+	}
+	assert.ErrorIs(t, r.Write(io.Discard), ErrUnsupportedTransferEncoding)
+}
+
+const benchRequest = "POST /submit?id=42&sort=desc HTTP/1.1\r\n" +
+	"Host: localhost:42069\r\n" +
+	"User-Agent: Mozilla/5.0 (X11; Linux x86_64; rv:128.0) Gecko/20100101 Firefox/128.0\r\n" +
+	"Accept: text/html,application/xhtml+xml,application/xml;q=0.9,*/*;q=0.8\r\n" +
+	"Accept-Language: en-GB,en;q=0.5\r\n" +
+	"Accept-Encoding: gzip, deflate, br\r\n" +
+	"Content-Type: application/x-www-form-urlencoded\r\n" +
+	"Cookie: session=5f2b8c1e9a; theme=dark\r\n" +
+	"Connection: keep-alive\r\n" +
+	"Content-Length: 27\r\n" +
+	"\r\n" +
+	"name=gopher&colour=blue&x=1"
+
+func BenchmarkRequestFromReader(b *testing.B) {
+	b.ReportAllocs()
+	b.SetBytes(int64(len(benchRequest)))
+	sr := strings.NewReader(benchRequest)
+	for range b.N {
+		sr.Reset(benchRequest)
+		if _, err := RequestFromReader(sr); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkReaderPipelined(b *testing.B) {
+	const n = 100
+	data := strings.Repeat(benchRequest, n)
+	b.ReportAllocs()
+	b.SetBytes(int64(len(data)))
+	sr := strings.NewReader(data)
+	for range b.N {
+		sr.Reset(data)
+		rr := NewReader(sr)
+		for range n {
+			if _, err := rr.ReadRequest(); err != nil {
+				b.Fatal(err)
+			}
+		}
+	}
+}
+
+func TestReaderRelease(t *testing.T) {
+	data := "GET /one HTTP/1.1\r\nHost: localhost\r\n\r\n" +
+		"GET /two HTTP/1.1\r\nHost: localhost\r\n\r\n"
+	rr := NewReader(strings.NewReader(data))
+	r, err := rr.ReadRequest()
+	require.NoError(t, err)
+	assert.Equal(t, "/one", r.Path())
+
+	rr.Release()
+	_, err = rr.ReadRequest()
+	assert.ErrorIs(t, err, errReaderReleased)
+
+	// Test: a reader with a pooled buffer starts empty
+	rr = NewReader(strings.NewReader(data))
+	r, err = rr.ReadRequest()
+	require.NoError(t, err)
+	assert.Equal(t, "/one", r.Path())
+	rr.Release()
+}
+
+func gzipped(t testing.TB, data string) string {
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	_, err := zw.Write([]byte(data))
+	require.NoError(t, err)
+	require.NoError(t, zw.Close())
+	return buf.String()
+}
+
+func deflated(t testing.TB, data string) string {
+	var buf bytes.Buffer
+	zw := zlib.NewWriter(&buf)
+	_, err := zw.Write([]byte(data))
+	require.NoError(t, err)
+	require.NoError(t, zw.Close())
+	return buf.String()
+}
+
+func encodedRequest(coding, body string) string {
+	return "POST / HTTP/1.1\r\n" +
+		"Host: localhost\r\n" +
+		"Content-Encoding: " + coding + "\r\n" +
+		"Content-Length: " + strconv.Itoa(len(body)) + "\r\n" +
+		"\r\n" +
+		body
+}
+
+func TestDecompressBody(t *testing.T) {
+	// Test: streamed gzip body
+	reader := &ChunkReader{
+		data:            encodedRequest("gzip", gzipped(t, "hello world")),
+		numBytesPerRead: 3,
+	}
+	r, err := NewReader(reader).ReadRequestHeader()
+	require.NoError(t, err)
+	require.NoError(t, r.DecompressBody())
+	_, ok := r.Headers.Get("Content-Encoding")
+	assert.False(t, ok)
+	_, ok = r.Headers.Get("Content-Length")
+	assert.False(t, ok)
+	body, err := r.ReadBody()
+	require.NoError(t, err)
+	assert.Equal(t, "hello world", string(body))
+
+	// Test: body read before decompressing
+	r, err = RequestFromReader(strings.NewReader(encodedRequest("deflate", deflated(t, "hello world"))))
+	require.NoError(t, err)
+	require.NoError(t, r.DecompressBody())
+	assert.Equal(t, "hello world", string(r.Body))
+
+	// Test: codings are removed in the reverse order they were applied
+	r, err = RequestFromReader(strings.NewReader(encodedRequest("deflate, identity, gzip", gzipped(t, deflated(t, "hello world")))))
+	require.NoError(t, err)
+	require.NoError(t, r.DecompressBody())
+	assert.Equal(t, "hello world", string(r.Body))
+
+	// Test: no content coding
+	r, err = RequestFromReader(strings.NewReader(encodedRequest("identity", "plain")))
+	require.NoError(t, err)
+	require.NoError(t, r.DecompressBody())
+	assert.Equal(t, "plain", string(r.Body))
+	assert.Equal(t, "5", r.Headers["content-length"])
+	assert.NotContains(t, r.Headers, "content-encoding")
+
+	// Test: unsupported coding
+	r, err = RequestFromReader(strings.NewReader(encodedRequest("br", "data")))
+	require.NoError(t, err)
+	assert.ErrorIs(t, r.DecompressBody(), ErrUnsupportedContentEncoding)
+	assert.Equal(t, "br", r.Headers["content-encoding"])
+
+	// Test: malformed body
+	r, err = NewReader(strings.NewReader(encodedRequest("gzip", "not gzip"))).ReadRequestHeader()
+	require.NoError(t, err)
+	require.NoError(t, r.DecompressBody())
+	_, err = r.ReadBody()
+	assert.ErrorIs(t, err, ErrMalformedContentEncoding)
+
+	// Test: truncated body
+	data := gzipped(t, "hello world")
+	r, err = NewReader(strings.NewReader(encodedRequest("gzip", data[:len(data)-4]))).ReadRequestHeader()
+	require.NoError(t, err)
+	require.NoError(t, r.DecompressBody())
+	_, err = r.ReadBody()
+	assert.ErrorIs(t, err, ErrMalformedContentEncoding)
+}
+
+func TestDecompressBodyLimit(t *testing.T) {
+	// a small body that decodes to far more than the limit
+	bomb := gzipped(t, strings.Repeat("a", 1<<20))
+	rr := NewReader(strings.NewReader(encodedRequest("gzip", bomb)))
+	rr.Limits.MaxDecompressedBytes = 1 << 10
+	r, err := rr.ReadRequestHeader()
+	require.NoError(t, err)
+	require.NoError(t, r.DecompressBody())
+	body, err := r.ReadBody()
+	assert.ErrorIs(t, err, ErrBodyTooLarge)
+	assert.Len(t, body, 1<<10)
+
+	// Test: a body at the limit
+	rr = NewReader(strings.NewReader(encodedRequest("gzip", gzipped(t, strings.Repeat("a", 1<<10)))))
+	rr.Limits.MaxDecompressedBytes = 1 << 10
+	r, err = rr.ReadRequestHeader()
+	require.NoError(t, err)
+	require.NoError(t, r.DecompressBody())
+	body, err = r.ReadBody()
+	require.NoError(t, err)
+	assert.Len(t, body, 1<<10)
+}
+
+func TestMethodValidation(t *testing.T) {
+	for _, method := range []string{"GET", "DELETE", "PROPFIND", "M-SEARCH", "BREW", "VERSION-CONTROL", "X_1"} {
+		r, err := RequestFromReader(strings.NewReader(method + " / HTTP/1.1\r\nHost: localhost\r\n\r\n"))
+		require.NoError(t, err, method)
+		assert.Equal(t, method, r.RequestLine.Method)
+	}
+
+	tests := []struct {
+		method string
+		offset int
+	}{
+		{method: "G@T", offset: 1},
+		{method: "123", offset: 0},
+		{method: "-GET", offset: 0},
+		{method: "GeT", offset: 1},
+		{method: "GET(", offset: 3},
+		{method: "G\x7fT", offset: 1},
+		{method: "GÉT", offset: 1},
+	}
+	for _, tt := range tests {
+		_, err := RequestFromReader(strings.NewReader(tt.method + " / HTTP/1.1\r\nHost: localhost\r\n\r\n"))
+		require.ErrorIs(t, err, ErrInvalidMethod, tt.method)
+		var perr *ParseError
+		require.ErrorAs(t, err, &perr)
+		assert.Equal(t, tt.offset, perr.Offset, tt.method)
+	}
+
+	assert.True(t, IsStandardMethod(MethodPatch))
+	assert.False(t, IsStandardMethod("PROPFIND"))
+	assert.False(t, IsStandardMethod("get"))
+	assert.Len(t, StandardMethods, 9)
+}
+
+func TestHost(t *testing.T) {
+	tests := []struct {
+		request string
+		host    string
+		port    string
+	}{
+		{request: "GET / HTTP/1.1\r\nHost: localhost:42069\r\n\r\n", host: "localhost", port: "42069"},
+		{request: "GET / HTTP/1.1\r\nHost: API.Example.TEST.\r\n\r\n", host: "api.example.test"},
+		{request: "GET / HTTP/1.1\r\nHost: [::1]:8080\r\n\r\n", host: "[::1]", port: "8080"},
+		{request: "GET / HTTP/1.1\r\nHost: 127.0.0.1\r\n\r\n", host: "127.0.0.1"},
+		{request: "GET / HTTP/1.1\r\nHost:\r\n\r\n", host: ""},
+		{request: "GET / HTTP/1.0\r\n\r\n", host: ""},
+		// the target's authority wins over the header
+		{request: "GET http://static.example.test:81/a HTTP/1.1\r\nHost: api.example.test\r\n\r\n", host: "static.example.test", port: "81"},
+		{request: "CONNECT example.test:443 HTTP/1.1\r\nHost: example.test:443\r\n\r\n", host: "example.test", port: "443"},
+	}
+	for _, tt := range tests {
+		r, err := RequestFromReader(strings.NewReader(tt.request))
+		require.NoError(t, err, tt.request)
+		assert.Equal(t, tt.host, r.Host, tt.request)
+		assert.Equal(t, tt.port, r.Port, tt.request)
+	}
+
+	// Test: HTTP/1.1 requests need a Host header
+	_, err := RequestFromReader(strings.NewReader("GET / HTTP/1.1\r\nAccept: */*\r\n\r\n"))
+	assert.ErrorIs(t, err, ErrMissingHost)
+
+	// Test: more than one Host header
+	_, err = RequestFromReader(strings.NewReader("GET / HTTP/1.1\r\nHost: a.test\r\nhost: a.test\r\n\r\n"))
+	assert.ErrorIs(t, err, ErrInvalidHost)
+	_, err = RequestFromReader(strings.NewReader("GET / HTTP/1.0\r\nHost: a.test\r\nHOST: b.test\r\n\r\n"))
+	assert.ErrorIs(t, err, ErrInvalidHost)
+
+	// Test: invalid Host values
+	for _, host := range []string{"a b", "a/b", "user@a.test", "a.test:port", "a.test:99999", "[::1", "::1", "[::g]", ":80", "[]", "[]:80", "[1.2.3.4]", "[fe80::1%eth0]"} {
+		_, err = RequestFromReader(strings.NewReader("GET / HTTP/1.1\r\nHost: " + host + "\r\n\r\n"))
+		assert.ErrorIs(t, err, ErrInvalidHost, host)
+	}
+}
+
+func TestRanges(t *testing.T) {
+	modTime := time.Date(2024, time.March, 1, 12, 0, 0, 500, time.UTC)
+	get := func(method string, fields ...string) *Request {
+		data := method + " /video HTTP/1.1\r\nHost: localhost\r\n"
+		for _, f := range fields {
+			data += f + "\r\n"
+		}
+		r, err := RequestFromReader(strings.NewReader(data + "\r\n"))
+		require.NoError(t, err)
+		return r
+	}
+
+	ranges, err := get("GET", "Range: bytes=0-9").Ranges(100, `"v1"`, modTime)
+	require.NoError(t, err)
+	assert.Equal(t, []headers.ByteRange{{Start: 0, Length: 10}}, ranges)
+
+	// Test: the whole representation is sent
+	for name, r := range map[string]*Request{
+		"no range":           get("GET"),
+		"not a get":          get("HEAD", "Range: bytes=0-9"),
+		"malformed":          get("GET", "Range: bytes=9-0"),
+		"more than whole":    get("GET", "Range: bytes=0-99,0-99"),
+		"too many":           get("GET", "Range: bytes="+strings.Repeat("0-0,", 101)),
+		"etag changed":       get("GET", "Range: bytes=0-9", `If-Range: "v0"`),
+		"weak etag":          get("GET", "Range: bytes=0-9", `If-Range: W/"v1"`),
+		"date changed":       get("GET", "Range: bytes=0-9", "If-Range: Fri, 01 Mar 2024 11:00:00 GMT"),
+		"malformed if-range": get("GET", "Range: bytes=0-9", "If-Range: soon"),
+	} {
+		ranges, err := r.Ranges(100, `"v1"`, modTime)
+		require.NoError(t, err, name)
+		assert.Nil(t, ranges, name)
+	}
+
+	// Test: If-Range conditions that hold
+	for _, ifRange := range []string{`"v1"`, "Fri, 01 Mar 2024 12:00:00 GMT"} {
+		ranges, err := get("GET", "Range: bytes=-5", "If-Range: "+ifRange).Ranges(100, `"v1"`, modTime)
+		require.NoError(t, err, ifRange)
+		assert.Equal(t, []headers.ByteRange{{Start: 95, Length: 5}}, ranges, ifRange)
+	}
+
+	_, err = get("GET", "Range: bytes=100-").Ranges(100, "", time.Time{})
+	assert.ErrorIs(t, err, headers.ErrRangeNotSatisfiable)
+}
+
+func TestEvaluatePreconditions(t *testing.T) {
+	modTime := time.Date(2024, time.March, 1, 12, 0, 0, 999, time.UTC)
+	const etag = `"v2"`
+	tests := []struct {
+		name   string
+		method string
+		fields []string
+		etag   string
+		want   Precondition
+	}{
+		{name: "no conditions", want: PreconditionPassed},
+		{name: "if-match", fields: []string{`If-Match: "v1", "v2"`}, want: PreconditionPassed},
+		{name: "if-match changed", fields: []string{`If-Match: "v1"`}, want: PreconditionFailed},
+		{name: "if-match weak", fields: []string{`If-Match: W/"v2"`}, want: PreconditionFailed},
+		{name: "if-match any", fields: []string{`If-Match: *`}, want: PreconditionPassed},
+		{name: "if-match any missing", fields: []string{`If-Match: *`}, etag: "-", want: PreconditionFailed},
+		{name: "if-unmodified-since", fields: []string{"If-Unmodified-Since: Fri, 01 Mar 2024 12:00:00 GMT"}, want: PreconditionPassed},
+		{name: "if-unmodified-since changed", fields: []string{"If-Unmodified-Since: Fri, 01 Mar 2024 11:59:59 GMT"}, want: PreconditionFailed},
+		{name: "if-unmodified-since invalid", fields: []string{"If-Unmodified-Since: yesterday"}, want: PreconditionPassed},
+		{name: "if-match before if-unmodified-since", fields: []string{`If-Match: "v2"`, "If-Unmodified-Since: Fri, 01 Mar 2024 11:00:00 GMT"}, want: PreconditionPassed},
+		{name: "if-none-match", fields: []string{`If-None-Match: W/"v2"`}, want: PreconditionNotModified},
+		{name: "if-none-match head", method: "HEAD", fields: []string{`If-None-Match: "v2"`}, want: PreconditionNotModified},
+		{name: "if-none-match changed", fields: []string{`If-None-Match: "v1"`}, want: PreconditionPassed},
+		{name: "if-none-match any", fields: []string{`If-None-Match: *`}, want: PreconditionNotModified},
+		{name: "if-none-match put", method: "PUT", fields: []string{`If-None-Match: *`}, want: PreconditionFailed},
+		{name: "if-modified-since", fields: []string{"If-Modified-Since: Fri, 01 Mar 2024 12:00:00 GMT"}, want: PreconditionNotModified},
+		{name: "if-modified-since changed", fields: []string{"If-Modified-Since: Fri, 01 Mar 2024 11:00:00 GMT"}, want: PreconditionPassed},
+		{name: "if-modified-since post", method: "POST", fields: []string{"If-Modified-Since: Fri, 01 Mar 2024 12:00:00 GMT"}, want: PreconditionPassed},
+		{name: "if-none-match before if-modified-since", fields: []string{`If-None-Match: "v1"`, "If-Modified-Since: Fri, 01 Mar 2024 12:00:00 GMT"}, want: PreconditionPassed},
+		{name: "if-match fails first", fields: []string{`If-Match: "v1"`, `If-None-Match: "v2"`}, want: PreconditionFailed},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			method := tt.method
+			if method == "" {
+				method = "GET"
+			}
+			data := method + " / HTTP/1.1\r\nHost: localhost\r\n"
+			for _, f := range tt.fields {
+				data += f + "\r\n"
+			}
+			r, err := RequestFromReader(strings.NewReader(data + "\r\n"))
+			require.NoError(t, err)
+			e, m := etag, modTime
+			if tt.etag == "-" {
+				// the resource doesn't exist
+				e, m = "", time.Time{}
+			}
+			assert.Equal(t, tt.want, r.EvaluatePreconditions(e, m))
+		})
+	}
+}
+
+func TestAuthorization(t *testing.T) {
+	parse := func(t *testing.T, authorization string) *Request {
+		data := "GET / HTTP/1.1\r\nHost: localhost\r\n"
+		if authorization != "" {
+			data += "Authorization: " + authorization + "\r\n"
+		}
+		r, err := RequestFromReader(strings.NewReader(data + "\r\n"))
+		require.NoError(t, err)
+		return r
+	}
+
+	_, err := parse(t, "").Authorization()
+	assert.ErrorIs(t, err, ErrNoAuthorization)
+	_, err = parse(t, "Basic a b").Authorization()
+	assert.ErrorIs(t, err, headers.ErrInvalidCredentials)
+
+	user, password, ok := parse(t, "basic "+base64.StdEncoding.EncodeToString([]byte("Aladdin:open:sesame"))).BasicAuth()
+	assert.True(t, ok)
+	assert.Equal(t, "Aladdin", user)
+	assert.Equal(t, "open:sesame", password)
+	for _, v := range []string{"", "Basic !!!", "Basic " + base64.StdEncoding.EncodeToString([]byte("nocolon")), "Bearer abc"} {
+		_, _, ok := parse(t, v).BasicAuth()
+		assert.False(t, ok, v)
+	}
+
+	token, ok := parse(t, "Bearer mF_9.B5f-4.1JqM").BearerToken()
+	assert.True(t, ok)
+	assert.Equal(t, "mF_9.B5f-4.1JqM", token)
+	_, ok = parse(t, "Basic abc").BearerToken()
+	assert.False(t, ok)
+	_, ok = parse(t, "Bearer").BearerToken()
+	assert.False(t, ok)
+}
@@ -0,0 +1,265 @@
+package request
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// TargetForm is one of the four request-target forms of RFC 9112 section 3.2
+type TargetForm int
+
+const (
+	// OriginForm is an absolute path with an optional query, "/where?q=now"
+	OriginForm TargetForm = iota
+	// AbsoluteForm is a full URI, used with proxies, "http://www.example.org/pub"
+	AbsoluteForm
+	// AuthorityForm is a host and port, only used by CONNECT, "www.example.com:80"
+	AuthorityForm
+	// AsteriskForm is "*", only used by a server-wide OPTIONS request
+	AsteriskForm
+)
+
+// Target is a parsed request-target
+type Target struct {
+	Form TargetForm
+	// Scheme is only set for the absolute-form
+	Scheme string
+	// Authority is the host and optional port of the absolute-form and
+	// authority-form
+	Authority string
+	// RawPath is the path as it was sent, still percent-encoded
+	RawPath string
+	// Path is the percent-decoded path with dot segments removed and
+	// repeated slashes collapsed, "/a/%2e%2e//b" becomes "/b"
+	Path string
+	// RawQuery is the query without the leading '?', still encoded
+	RawQuery string
+}
+
+// parseTarget parses the request-target of a request with the given method.
+// In strict mode a path containing an encoded slash or NUL is rejected. The
+// offset in a returned error is counted from the start of the target.
+func parseTarget(method, target string, strict bool) (Target, *ParseError) {
+	if target == "" {
+		return Target{}, &ParseError{Err: ErrInvalidTarget, Detail: "empty target"}
+	}
+	for i := 0; i < len(target); i++ {
+		c := target[i]
+		if c <= ' ' || c == 0x7f {
+			return Target{}, &ParseError{Err: ErrInvalidTarget, Offset: i, Detail: fmt.Sprintf("invalid character %q", c)}
+		}
+		if c == '#' {
+			return Target{}, &ParseError{Err: ErrInvalidTarget, Offset: i, Detail: "fragment not allowed"}
+		}
+	}
+
+	switch {
+	case method == MethodConnect:
+		return parseAuthorityForm(target)
+	case target == "*":
+		if method != MethodOptions {
+			return Target{}, &ParseError{Err: ErrInvalidTarget, Detail: "asterisk-form is only allowed for OPTIONS"}
+		}
+		return Target{Form: AsteriskForm}, nil
+	case strings.HasPrefix(target, "/"):
+		t := Target{Form: OriginForm}
+		if err := t.setPathAndQuery(target, 0, strict); err != nil {
+			return Target{}, err
+		}
+		return t, nil
+	default:
+		return parseAbsoluteForm(target, strict)
+	}
+}
+
+func parseAuthorityForm(target string) (Target, *ParseError) {
+	_, port, ok := splitHostPort(target)
+	if !ok || port == "" {
+		return Target{}, &ParseError{Err: ErrInvalidTarget, Detail: fmt.Sprintf("authority-form requires host:port, got %q", target)}
+	}
+	return Target{Form: AuthorityForm, Authority: target}, nil
+}
+
+// splitHostPort splits an authority into its host and optional port. An
+// IPv6 literal host keeps its brackets.
+func splitHostPort(hostport string) (host, port string, ok bool) {
+	host = hostport
+	if i := strings.LastIndexByte(hostport, ':'); i != -1 && !strings.HasSuffix(hostport, "]") {
+		host, port = hostport[:i], hostport[i+1:]
+		if !validPort(port) {
+			return "", "", false
+		}
+	}
+	if host == "" {
+		return "", "", false
+	}
+	if strings.HasPrefix(host, "[") != strings.HasSuffix(host, "]") {
+		return "", "", false
+	}
+	if !strings.HasPrefix(host, "[") && strings.Contains(host, ":") {
+		return "", "", false
+	}
+	return host, port, true
+}
+
+func parseAbsoluteForm(target string, strict bool) (Target, *ParseError) {
+	scheme, rest, ok := strings.Cut(target, "://")
+	if !ok || !validScheme(scheme) {
+		return Target{}, &ParseError{Err: ErrInvalidTarget, Detail: fmt.Sprintf("%q is not in origin-form or absolute-form", target)}
+	}
+	offset := len(scheme) + 3
+	end := strings.IndexAny(rest, "/?")
+	if end == -1 {
+		end = len(rest)
+	}
+	if _, _, ok := splitHostPort(rest[:end]); !ok {
+		return Target{}, &ParseError{Err: ErrInvalidTarget, Offset: offset, Detail: fmt.Sprintf("invalid authority %q", rest[:end])}
+	}
+	t := Target{
+		Form:      AbsoluteForm,
+		Scheme:    strings.ToLower(scheme),
+		Authority: rest[:end],
+	}
+	pathAndQuery := rest[end:]
+	if !strings.HasPrefix(pathAndQuery, "/") {
+		// an empty path is the same as "/"
+		pathAndQuery = "/" + pathAndQuery
+		offset--
+	}
+	if err := t.setPathAndQuery(pathAndQuery, offset+end, strict); err != nil {
+		return Target{}, err
+	}
+	return t, nil
+}
+
+// setPathAndQuery splits an absolute path with an optional query, offset
+// is where s starts in the target
+func (t *Target) setPathAndQuery(s string, offset int, strict bool) *ParseError {
+	rawPath, rawQuery, _ := strings.Cut(s, "?")
+	if strict {
+		for i := 0; i+2 < len(rawPath); i++ {
+			if rawPath[i] != '%' {
+				continue
+			}
+			switch strings.ToUpper(rawPath[i+1 : i+3]) {
+			case "2F":
+				return &ParseError{Err: ErrInvalidTarget, Offset: offset + i, Detail: "encoded slash in path"}
+			case "00":
+				return &ParseError{Err: ErrInvalidTarget, Offset: offset + i, Detail: "encoded NUL in path"}
+			}
+		}
+	}
+	path, err := unescape(rawPath, false)
+	if err != nil {
+		return &ParseError{Err: ErrInvalidTarget, Offset: offset + err.offset, Detail: err.Error()}
+	}
+	t.RawPath = rawPath
+	t.Path = cleanPath(path)
+	t.RawQuery = rawQuery
+	return nil
+}
+
+// cleanPath removes the "." and ".." segments of an absolute path as in
+// RFC 3986 section 5.2.4 and collapses repeated slashes. The path is
+// decoded first so an encoded "%2e%2e" is removed like "..", as is one
+// built from encoded slashes.
+func cleanPath(path string) string {
+	segments := strings.Split(path, "/")
+	out := make([]string, 0, len(segments))
+	for _, seg := range segments[1:] {
+		switch seg {
+		case "", ".":
+		case "..":
+			if len(out) > 0 {
+				out = out[:len(out)-1]
+			}
+		default:
+			out = append(out, seg)
+		}
+	}
+	cleaned := "/" + strings.Join(out, "/")
+	// "/a/", "/a/." and "/a/b/.." all keep a trailing slash
+	switch segments[len(segments)-1] {
+	case "", ".", "..":
+		if len(out) > 0 {
+			cleaned += "/"
+		}
+	}
+	return cleaned
+}
+
+func validScheme(scheme string) bool {
+	if scheme == "" {
+		return false
+	}
+	for i := 0; i < len(scheme); i++ {
+		c := scheme[i]
+		switch {
+		case c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z':
+		case i > 0 && (c >= '0' && c <= '9' || c == '+' || c == '-' || c == '.'):
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+func validPort(port string) bool {
+	if port == "" || len(port) > 5 {
+		return false
+	}
+	for i := 0; i < len(port); i++ {
+		if port[i] < '0' || port[i] > '9' {
+			return false
+		}
+	}
+	n, _ := strconv.Atoi(port)
+	return n <= 65535
+}
+
+// escapeError reports an invalid percent-encoding at offset
+type escapeError struct {
+	offset int
+	escape string
+}
+
+func (e *escapeError) Error() string {
+	return fmt.Sprintf("invalid escape %q", e.escape)
+}
+
+// unescape decodes the percent-encoded octets in s, and '+' as a space
+// when plusSpace is set as done for query strings
+func unescape(s string, plusSpace bool) (string, *escapeError) {
+	if !strings.ContainsAny(s, "%+") {
+		return s, nil
+	}
+	var b strings.Builder
+	b.Grow(len(s))
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; {
+		case c == '%':
+			if i+2 >= len(s) || !isHexDigit(s[i+1]) || !isHexDigit(s[i+2]) {
+				return "", &escapeError{offset: i, escape: s[i:min(i+3, len(s))]}
+			}
+			b.WriteByte(unhex(s[i+1])<<4 | unhex(s[i+2]))
+			i += 2
+		case c == '+' && plusSpace:
+			b.WriteByte(' ')
+		default:
+			b.WriteByte(c)
+		}
+	}
+	return b.String(), nil
+}
+
+func unhex(c byte) byte {
+	switch {
+	case c >= '0' && c <= '9':
+		return c - '0'
+	case c >= 'a' && c <= 'f':
+		return c - 'a' + 10
+	default:
+		return c - 'A' + 10
+	}
+}
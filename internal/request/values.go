@@ -0,0 +1,66 @@
+package request
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Values maps a parameter name to its values, in the order they were sent
+type Values map[string][]string
+
+// Get returns the first value for the key, or "" if there is none
+func (v Values) Get(key string) string {
+	if vs := v[key]; len(vs) > 0 {
+		return vs[0]
+	}
+	return ""
+}
+
+func (v Values) Has(key string) bool {
+	_, ok := v[key]
+	return ok
+}
+
+func (v Values) Add(key, value string) {
+	v[key] = append(v[key], value)
+}
+
+func (v Values) Set(key, value string) {
+	v[key] = []string{value}
+}
+
+func (v Values) Del(key string) {
+	delete(v, key)
+}
+
+// ParseQuery parses a query string such as "a=1&b=2&a=3". Parsing carries
+// on past malformed pairs, which are left out of the result, and the first
+// such error is returned.
+func ParseQuery(query string) (Values, error) {
+	v := Values{}
+	var firstErr error
+	for query != "" {
+		var pair string
+		pair, query, _ = strings.Cut(query, "&")
+		if pair == "" {
+			continue
+		}
+		rawKey, rawValue, _ := strings.Cut(pair, "=")
+		key, err := unescape(rawKey, true)
+		if err != nil {
+			if firstErr == nil {
+				firstErr = fmt.Errorf("invalid query key %q: %w", rawKey, err)
+			}
+			continue
+		}
+		value, err := unescape(rawValue, true)
+		if err != nil {
+			if firstErr == nil {
+				firstErr = fmt.Errorf("invalid query value %q: %w", rawValue, err)
+			}
+			continue
+		}
+		v.Add(key, value)
+	}
+	return v, firstErr
+}
@@ -0,0 +1,107 @@
+package request
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"maps"
+	"slices"
+	"strconv"
+
+	"github.com/P-H-Pancholi/httpfromtcp/internal/headers"
+)
+
+// Write sends the request in wire format. Headers are written in sorted
+// order so the output is deterministic. A body with Transfer-Encoding:
+// chunked is sent in chunks followed by the Trailers, any other body is
+// sent with a Content-Length matching Body. A streamed body that hasn't
+// been read yet is read first.
+func (r *Request) Write(w io.Writer) error {
+	method := r.RequestLine.Method
+	if method == "" {
+		method = MethodGet
+	}
+	target := r.RequestLine.RequestTarget
+	if target == "" {
+		target = "/"
+	}
+	version := r.RequestLine.HttpVersion
+	if version == "" {
+		version = "1.1"
+	}
+
+	h := maps.Clone(r.Headers)
+	if h == nil {
+		h = headers.NewHeaders()
+	}
+	te, chunked := h.Get("Transfer-Encoding")
+	if chunked {
+		if err := checkTransferEncoding(te); err != nil {
+			return fmt.Errorf("%w: %q", err, te)
+		}
+		h.Remove("Content-Length")
+	} else {
+		if _, err := r.ReadBody(); err != nil {
+			return err
+		}
+		_, hasCL := h.Get("Content-Length")
+		if hasCL || len(r.Body) > 0 || expectsBody(method) {
+			h.Override("Content-Length", strconv.Itoa(len(r.Body)))
+		}
+	}
+
+	bw := bufio.NewWriter(w)
+	fmt.Fprintf(bw, "%s %s HTTP/%s\r\n", method, target, version)
+	writeFields(bw, h)
+	bw.WriteString(crlf)
+
+	if chunked {
+		if err := writeChunked(bw, r.BodyReader()); err != nil {
+			return err
+		}
+		writeFields(bw, r.Trailers)
+		bw.WriteString(crlf)
+	} else {
+		bw.Write(r.Body)
+	}
+	return bw.Flush()
+}
+
+// writeFields writes the field lines of h sorted by name
+func writeFields(bw *bufio.Writer, h headers.Headers) {
+	for _, key := range slices.Sorted(maps.Keys(h)) {
+		fmt.Fprintf(bw, "%s: %s\r\n", key, h[key])
+	}
+}
+
+// writeChunked copies body as chunks and ends it with the last-chunk, the
+// trailer section is left to the caller
+func writeChunked(bw *bufio.Writer, body io.Reader) error {
+	buf := make([]byte, 32<<10)
+	for {
+		n, err := body.Read(buf)
+		if n > 0 {
+			fmt.Fprintf(bw, "%x\r\n", n)
+			bw.Write(buf[:n])
+			bw.WriteString(crlf)
+		}
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+	}
+	_, err := bw.WriteString("0\r\n")
+	return err
+}
+
+// expectsBody reports whether requests with the method are expected to
+// carry a body, those get a Content-Length even when it is empty
+func expectsBody(method string) bool {
+	switch method {
+	case MethodPost, MethodPut, MethodPatch:
+		return true
+	}
+	return false
+}
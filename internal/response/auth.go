@@ -0,0 +1,32 @@
+package response
+
+import (
+	"errors"
+	"strings"
+
+	"github.com/P-H-Pancholi/httpfromtcp/internal/headers"
+)
+
+// WriteUnauthorized answers 401 Unauthorized with a WWW-Authenticate
+// header listing the challenges the client can answer, at least one is
+// required by RFC 9110 section 15.5.2
+func (w *Writer) WriteUnauthorized(challenges ...headers.Challenge) error {
+	if len(challenges) == 0 {
+		return errors.New("no challenges to write")
+	}
+	body := []byte("Unauthorized")
+	if err := w.WriteStatusLine(httpUnauthorized); err != nil {
+		return err
+	}
+	values := make([]string, len(challenges))
+	for i, c := range challenges {
+		values[i] = c.String()
+	}
+	h := GetDefaultHeaders(len(body))
+	h.Override("WWW-Authenticate", strings.Join(values, ", "))
+	if err := w.WriteHeaders(h); err != nil {
+		return err
+	}
+	_, err := w.WriteBody(body)
+	return err
+}
@@ -0,0 +1,42 @@
+package response
+
+import "github.com/P-H-Pancholi/httpfromtcp/internal/headers"
+
+// notModifiedHeaders are the fields a 304 response keeps from the 200
+// response it stands for, RFC 9110 section 15.4.5
+var notModifiedHeaders = []string{
+	"Cache-Control", "Content-Location", "Date", "ETag", "Expires", "Vary",
+	"Last-Modified",
+}
+
+// WriteNotModified answers 304 Not Modified. h holds the headers of the
+// 200 response that would have been sent, only the ones that describe
+// the cached representation are kept.
+func (w *Writer) WriteNotModified(h headers.Headers) error {
+	out := headers.NewHeaders()
+	for _, name := range notModifiedHeaders {
+		if v, ok := h.Get(name); ok {
+			out.Override(name, v)
+		}
+	}
+	if v, ok := h.Get("Connection"); ok {
+		out.Override("Connection", v)
+	}
+	if err := w.WriteStatusLine(httpNotModified); err != nil {
+		return err
+	}
+	return w.WriteHeaders(out)
+}
+
+// WritePreconditionFailed answers 412 Precondition Failed
+func (w *Writer) WritePreconditionFailed() error {
+	body := []byte("Precondition Failed")
+	if err := w.WriteStatusLine(httpPreconditionFailed); err != nil {
+		return err
+	}
+	if err := w.WriteHeaders(GetDefaultHeaders(len(body))); err != nil {
+		return err
+	}
+	_, err := w.WriteBody(body)
+	return err
+}
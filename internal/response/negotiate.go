@@ -0,0 +1,21 @@
+package response
+
+// WriteNotAcceptable answers 406 Not Acceptable when none of the
+// representations of a resource match the Accept fields of the request.
+// vary lists those fields so caches don't reuse the answer for other
+// clients, it is left out when empty.
+func (w *Writer) WriteNotAcceptable(vary string) error {
+	body := []byte("Not Acceptable")
+	if err := w.WriteStatusLine(httpNotAcceptable); err != nil {
+		return err
+	}
+	h := GetDefaultHeaders(len(body))
+	if vary != "" {
+		h.Override("Vary", vary)
+	}
+	if err := w.WriteHeaders(h); err != nil {
+		return err
+	}
+	_, err := w.WriteBody(body)
+	return err
+}
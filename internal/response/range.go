@@ -0,0 +1,105 @@
+package response
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"io"
+	"maps"
+	"strconv"
+
+	"github.com/P-H-Pancholi/httpfromtcp/internal/headers"
+)
+
+// WritePartialContent answers with ranges of content, a representation of
+// size bytes, as 206 Partial Content. h holds the headers of the whole
+// representation, its Content-Length and Content-Range are set by
+// WritePartialContent. A single range is sent as it is, several are sent
+// as a multipart/byteranges body with one part per range.
+func (w *Writer) WritePartialContent(h headers.Headers, content io.ReaderAt, size int64, ranges []headers.ByteRange) error {
+	if len(ranges) == 0 {
+		return errors.New("no ranges to write")
+	}
+	h = maps.Clone(h)
+	h.Remove("Transfer-Encoding")
+
+	if len(ranges) == 1 {
+		br := ranges[0]
+		h.Override("Content-Length", strconv.FormatInt(br.Length, 10))
+		h.Override("Content-Range", br.ContentRange(size))
+		if err := w.WriteStatusLine(httpPartialContent); err != nil {
+			return err
+		}
+		if err := w.WriteHeaders(h); err != nil {
+			return err
+		}
+		_, err := io.Copy(bodyWriter{w}, io.NewSectionReader(content, br.Start, br.Length))
+		return err
+	}
+
+	boundary, err := randomBoundary()
+	if err != nil {
+		return err
+	}
+	contentType, _ := h.Get("Content-Type")
+	// every part header starts with the delimiter, RFC 9110 section 14.6
+	partHeaders := make([]string, len(ranges))
+	closing := "\r\n--" + boundary + "--\r\n"
+	length := int64(len(closing))
+	for i, br := range ranges {
+		ph := "\r\n--" + boundary + "\r\n"
+		if contentType != "" {
+			ph += "content-type: " + contentType + "\r\n"
+		}
+		ph += "content-range: " + br.ContentRange(size) + "\r\n\r\n"
+		partHeaders[i] = ph
+		length += int64(len(ph)) + br.Length
+	}
+
+	h.Override("Content-Type", "multipart/byteranges; boundary="+boundary)
+	h.Override("Content-Length", strconv.FormatInt(length, 10))
+	if err := w.WriteStatusLine(httpPartialContent); err != nil {
+		return err
+	}
+	if err := w.WriteHeaders(h); err != nil {
+		return err
+	}
+	for i, br := range ranges {
+		if _, err := w.WriteBody([]byte(partHeaders[i])); err != nil {
+			return err
+		}
+		if _, err := io.Copy(bodyWriter{w}, io.NewSectionReader(content, br.Start, br.Length)); err != nil {
+			return err
+		}
+	}
+	_, err = w.WriteBody([]byte(closing))
+	return err
+}
+
+// WriteRangeNotSatisfiable answers 416 Range Not Satisfiable for a
+// representation of size bytes
+func (w *Writer) WriteRangeNotSatisfiable(size int64) error {
+	if err := w.WriteStatusLine(httpRangeNotSatisfiable); err != nil {
+		return err
+	}
+	h := GetDefaultHeaders(0)
+	h.Override("Content-Range", "bytes */"+strconv.FormatInt(size, 10))
+	return w.WriteHeaders(h)
+}
+
+// bodyWriter writes to the body of a response
+type bodyWriter struct {
+	w *Writer
+}
+
+func (b bodyWriter) Write(p []byte) (int, error) {
+	return b.w.WriteBody(p)
+}
+
+func randomBoundary() (string, error) {
+	var buf [16]byte
+	if _, err := rand.Read(buf[:]); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(buf[:]), nil
+}
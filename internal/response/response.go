@@ -4,6 +4,7 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"maps"
 	"strconv"
 
 	"github.com/P-H-Pancholi/httpfromtcp/internal/headers"
@@ -12,9 +13,25 @@ import (
 type StatusCode int64
 
 const (
-	httpOk                  StatusCode = 200
-	httpBadReq              StatusCode = 400
-	httpInternalServerError StatusCode = 500
+	httpContinue                    StatusCode = 100
+	httpOk                          StatusCode = 200
+	httpNoContent                   StatusCode = 204
+	httpPartialContent              StatusCode = 206
+	httpNotModified                 StatusCode = 304
+	httpBadReq                      StatusCode = 400
+	httpUnauthorized                StatusCode = 401
+	httpNotFound                    StatusCode = 404
+	httpNotAcceptable               StatusCode = 406
+	httpPreconditionFailed          StatusCode = 412
+	httpContentTooLarge             StatusCode = 413
+	httpURITooLong                  StatusCode = 414
+	httpUnsupportedMediaType        StatusCode = 415
+	httpRangeNotSatisfiable         StatusCode = 416
+	httpExpectationFailed           StatusCode = 417
+	httpRequestHeaderFieldsTooLarge StatusCode = 431
+	httpInternalServerError         StatusCode = 500
+	httpNotImplemented              StatusCode = 501
+	httpVersionNotSupported         StatusCode = 505
 )
 
 type writerState int
@@ -24,37 +41,145 @@ const (
 	statusLineState
 	headerState
 	bodyState
+	trailerState
+	doneState
 )
 
 type Writer struct {
-	data  *io.Writer
-	state writerState
+	data   *io.Writer
+	state  writerState
+	status StatusCode
+
+	// keepAlive is false once the connection has to be closed after
+	// this response, either because the client or the handler asked
+	// for it or because the body length can't be determined otherwise
+	keepAlive bool
+	// contentLength is the declared body length, -1 when the body is
+	// chunked or delimited by closing the connection
+	contentLength int
+	bodyWritten   int
+	// cookies are written as one Set-Cookie line each
+	cookies []*headers.Cookie
+	// http10 is set for HTTP/1.0 clients, unchunked is set when a chunked
+	// body is sent to one of them as is, delimited by closing the connection
+	http10    bool
+	unchunked bool
+	// head is set for HEAD requests. noBody is set when the response
+	// can't have a body, anything written to it is dropped.
+	head   bool
+	noBody bool
 }
 
 func NewWriter(wr io.Writer) Writer {
 	w := Writer{
-		data:  &wr,
-		state: initState,
+		data:          &wr,
+		state:         initState,
+		keepAlive:     true,
+		contentLength: -1,
 	}
 	return w
 }
 
+// SetKeepAlive controls whether the connection stays open after the
+// response. It must be called before WriteHeaders, when keep-alive is
+// disabled a Connection: close header is sent.
+func (w *Writer) SetKeepAlive(keepAlive bool) {
+	w.keepAlive = keepAlive
+}
+
+// SetRequestVersion tells the writer the HTTP version of the request, "1.0"
+// or "1.1". HTTP/1.0 clients don't understand chunked bodies, so those are
+// sent without the chunk framing and end when the connection is closed.
+func (w *Writer) SetRequestVersion(version string) {
+	w.http10 = version == "1.0"
+}
+
+// SetRequestMethod tells the writer the method of the request. The
+// response to HEAD has the headers of a GET response but no body, so its
+// Content-Length doesn't have to be matched.
+func (w *Writer) SetRequestMethod(method string) {
+	w.head = method == "HEAD"
+}
+
+// KeepAlive reports whether the connection can be reused once the response
+// has been finished
+func (w *Writer) KeepAlive() bool {
+	return w.keepAlive
+}
+
+// SetCookie adds a Set-Cookie header to the response. It must be called
+// before WriteHeaders.
+func (w *Writer) SetCookie(c *headers.Cookie) error {
+	if w.state != initState && w.state != statusLineState {
+		return errors.New("improper sequence")
+	}
+	if err := c.Valid(); err != nil {
+		return err
+	}
+	w.cookies = append(w.cookies, c)
+	return nil
+}
+
+// WriteContinue sends the interim 100 Continue response. It fails once the
+// final response has been started.
+func (w *Writer) WriteContinue() error {
+	if w.state != initState {
+		return errors.New("improper sequence")
+	}
+	writer := *w.data
+	_, err := writer.Write([]byte("HTTP/1.1 100 Continue\r\n\r\n"))
+	return err
+}
+
 func (w *Writer) WriteStatusLine(statusCode StatusCode) error {
 	if w.state != initState {
 		return errors.New("improper sequence")
 	}
 	s := "HTTP/1.1" + " " + strconv.Itoa(int(statusCode)) + " "
 	switch statusCode {
+	case httpContinue:
+		s += "Continue"
 	case httpOk:
 		s += "OK"
+	case httpNoContent:
+		s += "No Content"
+	case httpPartialContent:
+		s += "Partial Content"
+	case httpNotModified:
+		s += "Not Modified"
 	case httpBadReq:
 		s += "Bad Request"
+	case httpUnauthorized:
+		s += "Unauthorized"
+	case httpNotFound:
+		s += "Not Found"
+	case httpNotAcceptable:
+		s += "Not Acceptable"
+	case httpPreconditionFailed:
+		s += "Precondition Failed"
+	case httpContentTooLarge:
+		s += "Content Too Large"
+	case httpURITooLong:
+		s += "URI Too Long"
+	case httpUnsupportedMediaType:
+		s += "Unsupported Media Type"
+	case httpRangeNotSatisfiable:
+		s += "Range Not Satisfiable"
+	case httpExpectationFailed:
+		s += "Expectation Failed"
+	case httpRequestHeaderFieldsTooLarge:
+		s += "Request Header Fields Too Large"
 	case httpInternalServerError:
 		s += "Internal Server Error"
+	case httpNotImplemented:
+		s += "Not Implemented"
+	case httpVersionNotSupported:
+		s += "HTTP Version Not Supported"
 	}
 	s += "\r\n"
 	writer := *w.data
 	writer.Write([]byte(s))
+	w.status = statusCode
 	w.state = statusLineState
 	return nil
 }
@@ -64,12 +189,52 @@ func (w *Writer) WriteHeaders(h headers.Headers) error {
 		return errors.New("improper sequence")
 	}
 
+	h = maps.Clone(h)
+	if h.HasToken("Connection", "close") {
+		w.keepAlive = false
+	}
+	w.noBody = w.head || bodyless(w.status)
+	if w.noBody {
+		// a Content-Length describes the representation the response
+		// stands for, not a body
+		w.contentLength = 0
+	} else if h.HasToken("Transfer-Encoding", "chunked") {
+		w.contentLength = -1
+		if w.http10 {
+			h.Remove("Transfer-Encoding")
+			h.Remove("Trailer")
+			w.unchunked = true
+			w.keepAlive = false
+		}
+	} else if v, ok := h.Get("Content-Length"); ok {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			return fmt.Errorf("invalid content-length: %s", v)
+		}
+		w.contentLength = n
+	} else {
+		// the body ends when the connection is closed
+		w.keepAlive = false
+	}
+	if !w.keepAlive {
+		h.Override("Connection", "close")
+	} else if w.http10 {
+		// HTTP/1.0 connections close by default
+		h.Override("Connection", "keep-alive")
+	}
+
 	// Write ALL headers, not just specific ones
 	for key, value := range h {
 		s := fmt.Sprintf("%s: %s\r\n", key, value)
 		writer := *w.data
 		writer.Write([]byte(s))
 	}
+	// Set-Cookie can't be combined into one line like other headers
+	for _, c := range w.cookies {
+		s := fmt.Sprintf("set-cookie: %s\r\n", c)
+		writer := *w.data
+		writer.Write([]byte(s))
+	}
 
 	// End headers section
 	writer := *w.data
@@ -82,8 +247,14 @@ func (w *Writer) WriteBody(p []byte) (int, error) {
 	if w.state != headerState {
 		return 0, errors.New("improper sequence")
 	}
+	if w.noBody {
+		// the client doesn't expect a body, it would be read as the
+		// start of the next response
+		return len(p), nil
+	}
 	writer := *w.data
 	writer.Write(p)
+	w.bodyWritten += len(p)
 	return len(p), nil
 }
 
@@ -91,7 +262,14 @@ func (w *Writer) WriteChunkedBody(p []byte) (int, error) {
 	if w.state != headerState {
 		return 0, errors.New("improper sequence")
 	}
+	if w.noBody {
+		return len(p), nil
+	}
 	wr := *w.data
+	if w.unchunked {
+		wr.Write(p)
+		return len(p), nil
+	}
 	s := fmt.Sprintf("%x\r\n", len(p))
 	wr.Write([]byte(s))
 	wr.Write(p)
@@ -103,12 +281,23 @@ func (w *Writer) WriteChunkedBodyDone() (int, error) {
 	if w.state != headerState {
 		return 0, errors.New("improper sequence")
 	}
-	wr := *w.data
-	wr.Write([]byte("0\r\n"))
+	if !w.unchunked && !w.noBody {
+		wr := *w.data
+		wr.Write([]byte("0\r\n"))
+	}
+	w.state = trailerState
 	return 0, nil
 }
 
 func (w *Writer) WriteTrailers(h headers.Headers) error {
+	if w.state != trailerState {
+		return errors.New("improper sequence")
+	}
+	if w.unchunked || w.noBody {
+		// there is no way to send trailers without chunked framing
+		w.state = doneState
+		return nil
+	}
 
 	s := ""
 	xSHA, _ := h.Get("X-Content-Sha256")
@@ -119,6 +308,31 @@ func (w *Writer) WriteTrailers(h headers.Headers) error {
 	s += "\r\n"
 	wr := *w.data
 	wr.Write([]byte(s))
+	w.state = doneState
+	return nil
+}
+
+// Finish completes the response once the handler has returned. A chunked
+// body without trailers is terminated, and a response that was never
+// written or is shorter than its Content-Length stops the connection from
+// being reused.
+func (w *Writer) Finish() error {
+	switch w.state {
+	case trailerState:
+		if !w.unchunked && !w.noBody {
+			wr := *w.data
+			wr.Write([]byte("\r\n"))
+		}
+		w.state = doneState
+	case headerState:
+		if w.contentLength == -1 || w.bodyWritten != w.contentLength {
+			w.keepAlive = false
+		}
+		w.state = doneState
+	case doneState:
+	default:
+		w.keepAlive = false
+	}
 	return nil
 }
 
@@ -140,7 +354,6 @@ func (w *Writer) WriteTrailers(h headers.Headers) error {
 func GetDefaultHeaders(contentLen int) headers.Headers {
 	h := headers.Headers{}
 	h["content-length"] = strconv.Itoa(contentLen)
-	h["connection"] = "close"
 	h["content-type"] = "text/plain"
 	return h
 }
@@ -171,3 +384,9 @@ func GetDefaultHeaders(contentLen int) headers.Headers {
 // 	w.Write([]byte(s))
 // 	return nil
 // }
+
+// bodyless reports whether responses with the status never have a body,
+// RFC 9110 section 6.4.1
+func bodyless(status StatusCode) bool {
+	return status < 200 || status == httpNoContent || status == httpNotModified
+}
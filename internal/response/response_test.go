@@ -0,0 +1,238 @@
+package response
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/P-H-Pancholi/httpfromtcp/internal/headers"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSetCookie(t *testing.T) {
+	var buf bytes.Buffer
+	w := NewWriter(&buf)
+	require.NoError(t, w.SetCookie(&headers.Cookie{Name: "a", Value: "1", Path: "/"}))
+	require.NoError(t, w.WriteStatusLine(200))
+	require.NoError(t, w.SetCookie(&headers.Cookie{Name: "b", Value: "2", HttpOnly: true}))
+	assert.Error(t, w.SetCookie(&headers.Cookie{Name: "bad name"}))
+	require.NoError(t, w.WriteHeaders(GetDefaultHeaders(0)))
+	assert.Error(t, w.SetCookie(&headers.Cookie{Name: "c", Value: "3"}))
+
+	lines := strings.Split(buf.String(), "\r\n")
+	assert.Contains(t, lines, "set-cookie: a=1; Path=/")
+	assert.Contains(t, lines, "set-cookie: b=2; HttpOnly")
+	assert.True(t, strings.HasSuffix(buf.String(), "\r\n\r\n"))
+}
+
+func TestHTTP10ChunkedBody(t *testing.T) {
+	var buf bytes.Buffer
+	w := NewWriter(&buf)
+	w.SetRequestVersion("1.0")
+	h := GetDefaultHeaders(0)
+	h.Remove("Content-Length")
+	h.Override("Transfer-Encoding", "chunked")
+	h.Override("Trailer", "X-Content-Sha256, X-Content-Length")
+	require.NoError(t, w.WriteStatusLine(200))
+	require.NoError(t, w.WriteHeaders(h))
+	_, err := w.WriteChunkedBody([]byte("hello "))
+	require.NoError(t, err)
+	_, err = w.WriteChunkedBody([]byte("world"))
+	require.NoError(t, err)
+	_, err = w.WriteChunkedBodyDone()
+	require.NoError(t, err)
+	require.NoError(t, w.WriteTrailers(headers.Headers{"x-content-length": "11"}))
+	require.NoError(t, w.Finish())
+	assert.False(t, w.KeepAlive())
+
+	head, body, ok := strings.Cut(buf.String(), "\r\n\r\n")
+	require.True(t, ok)
+	assert.Equal(t, "hello world", body)
+	assert.NotContains(t, head, "transfer-encoding")
+	assert.NotContains(t, head, "trailer")
+	assert.Contains(t, head, "connection: close")
+
+	// Test: the caller's headers are left untouched
+	assert.Equal(t, "chunked", h["transfer-encoding"])
+}
+
+func TestHTTP10KeepAlive(t *testing.T) {
+	var buf bytes.Buffer
+	w := NewWriter(&buf)
+	w.SetRequestVersion("1.0")
+	require.NoError(t, w.WriteStatusLine(200))
+	require.NoError(t, w.WriteHeaders(GetDefaultHeaders(2)))
+	_, err := w.WriteBody([]byte("ok"))
+	require.NoError(t, err)
+	require.NoError(t, w.Finish())
+	assert.True(t, w.KeepAlive())
+	assert.Contains(t, buf.String(), "connection: keep-alive\r\n")
+}
+
+func TestWritePartialContent(t *testing.T) {
+	content := strings.NewReader("0123456789abcdefghij")
+	h := GetDefaultHeaders(20)
+	h.Override("Content-Type", "video/mp4")
+
+	var buf bytes.Buffer
+	w := NewWriter(&buf)
+	require.NoError(t, w.WritePartialContent(h, content, 20, []headers.ByteRange{{Start: 5, Length: 5}}))
+	assert.Equal(t, "HTTP/1.1 206 Partial Content", strings.Split(buf.String(), "\r\n")[0])
+	lines := strings.Split(buf.String(), "\r\n")
+	assert.Contains(t, lines, "content-length: 5")
+	assert.Contains(t, lines, "content-range: bytes 5-9/20")
+	assert.Contains(t, lines, "content-type: video/mp4")
+	assert.True(t, strings.HasSuffix(buf.String(), "\r\n\r\n56789"))
+	assert.Equal(t, "20", h["content-length"], "headers of the caller are left alone")
+
+	// Test: several ranges are sent as multipart/byteranges
+	buf.Reset()
+	w = NewWriter(&buf)
+	require.NoError(t, w.WritePartialContent(h, content, 20, []headers.ByteRange{{Start: 0, Length: 3}, {Start: 17, Length: 3}}))
+	resp, err := http.ReadResponse(bufio.NewReader(&buf), nil)
+	require.NoError(t, err)
+	assert.Equal(t, 206, resp.StatusCode)
+	mediaType, params, err := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+	require.NoError(t, err)
+	assert.Equal(t, "multipart/byteranges", mediaType)
+
+	mr := multipart.NewReader(resp.Body, params["boundary"])
+	for _, want := range []struct{ contentRange, body string }{
+		{"bytes 0-2/20", "012"},
+		{"bytes 17-19/20", "hij"},
+	} {
+		p, err := mr.NextPart()
+		require.NoError(t, err)
+		assert.Equal(t, "video/mp4", p.Header.Get("Content-Type"))
+		assert.Equal(t, want.contentRange, p.Header.Get("Content-Range"))
+		body, err := io.ReadAll(p)
+		require.NoError(t, err)
+		assert.Equal(t, want.body, string(body))
+	}
+	_, err = mr.NextPart()
+	assert.ErrorIs(t, err, io.EOF)
+	// the declared length matches the body
+	_, err = resp.Body.Read(make([]byte, 1))
+	assert.ErrorIs(t, err, io.EOF)
+	assert.True(t, w.KeepAlive())
+}
+
+func TestWriteRangeNotSatisfiable(t *testing.T) {
+	var buf bytes.Buffer
+	w := NewWriter(&buf)
+	require.NoError(t, w.WriteRangeNotSatisfiable(20))
+	lines := strings.Split(buf.String(), "\r\n")
+	assert.Equal(t, "HTTP/1.1 416 Range Not Satisfiable", lines[0])
+	assert.Contains(t, lines, "content-range: bytes */20")
+	assert.Contains(t, lines, "content-length: 0")
+}
+
+func TestWriteNotModified(t *testing.T) {
+	var buf bytes.Buffer
+	w := NewWriter(&buf)
+	h := GetDefaultHeaders(1234)
+	h.Override("ETag", `"v1"`)
+	h.Override("Cache-Control", "max-age=60")
+	require.NoError(t, w.WriteNotModified(h))
+	require.NoError(t, w.Finish())
+
+	assert.Equal(t, "HTTP/1.1 304 Not Modified\r\n", buf.String()[:len("HTTP/1.1 304 Not Modified\r\n")])
+	lines := strings.Split(buf.String(), "\r\n")
+	assert.Contains(t, lines, `etag: "v1"`)
+	assert.Contains(t, lines, "cache-control: max-age=60")
+	assert.NotContains(t, buf.String(), "content-type")
+	assert.True(t, strings.HasSuffix(buf.String(), "\r\n\r\n"))
+	// without a body the connection can be reused
+	assert.True(t, w.KeepAlive())
+}
+
+func TestWritePreconditionFailed(t *testing.T) {
+	var buf bytes.Buffer
+	w := NewWriter(&buf)
+	require.NoError(t, w.WritePreconditionFailed())
+	require.NoError(t, w.Finish())
+	assert.True(t, strings.HasPrefix(buf.String(), "HTTP/1.1 412 Precondition Failed\r\n"))
+	assert.True(t, strings.HasSuffix(buf.String(), "\r\n\r\nPrecondition Failed"))
+	assert.True(t, w.KeepAlive())
+}
+
+func TestWriteNotAcceptable(t *testing.T) {
+	var buf bytes.Buffer
+	w := NewWriter(&buf)
+	require.NoError(t, w.WriteNotAcceptable("Accept, Accept-Language"))
+	require.NoError(t, w.Finish())
+	assert.True(t, strings.HasPrefix(buf.String(), "HTTP/1.1 406 Not Acceptable\r\n"))
+	assert.Contains(t, strings.Split(buf.String(), "\r\n"), "vary: Accept, Accept-Language")
+	assert.True(t, strings.HasSuffix(buf.String(), "\r\n\r\nNot Acceptable"))
+}
+
+func TestWriteUnauthorized(t *testing.T) {
+	var buf bytes.Buffer
+	w := NewWriter(&buf)
+	require.NoError(t, w.WriteUnauthorized(
+		headers.Challenge{Scheme: "Basic", Params: map[string]string{"realm": "internal"}},
+		headers.Challenge{Scheme: "Bearer", Params: map[string]string{"realm": "internal"}},
+	))
+	require.NoError(t, w.Finish())
+	assert.True(t, strings.HasPrefix(buf.String(), "HTTP/1.1 401 Unauthorized\r\n"))
+	assert.Contains(t, strings.Split(buf.String(), "\r\n"), `www-authenticate: Basic realm="internal", Bearer realm="internal"`)
+	assert.True(t, strings.HasSuffix(buf.String(), "\r\n\r\nUnauthorized"))
+}
+
+func TestBodylessResponses(t *testing.T) {
+	// a HEAD response declares the length of the GET body without sending it
+	var buf bytes.Buffer
+	w := NewWriter(&buf)
+	w.SetRequestMethod("HEAD")
+	require.NoError(t, w.WriteStatusLine(200))
+	require.NoError(t, w.WriteHeaders(GetDefaultHeaders(5)))
+	_, err := w.WriteBody([]byte("hello"))
+	require.NoError(t, err)
+	require.NoError(t, w.Finish())
+	assert.True(t, w.KeepAlive())
+	assert.Contains(t, strings.Split(buf.String(), "\r\n"), "content-length: 5")
+	assert.True(t, strings.HasSuffix(buf.String(), "\r\n\r\n"))
+	assert.NotContains(t, buf.String(), "hello")
+
+	// a chunked HEAD response has no chunks either
+	buf.Reset()
+	w = NewWriter(&buf)
+	w.SetRequestMethod("HEAD")
+	require.NoError(t, w.WriteStatusLine(200))
+	h := GetDefaultHeaders(0)
+	h.Remove("Content-Length")
+	h.Override("Transfer-Encoding", "chunked")
+	require.NoError(t, w.WriteHeaders(h))
+	_, err = w.WriteChunkedBody([]byte("hello"))
+	require.NoError(t, err)
+	_, err = w.WriteChunkedBodyDone()
+	require.NoError(t, err)
+	require.NoError(t, w.Finish())
+	assert.True(t, w.KeepAlive())
+	assert.True(t, strings.HasSuffix(buf.String(), "\r\n\r\n"))
+	assert.NotContains(t, buf.String(), "hello")
+
+	// 204 has no body and needs no Content-Length
+	buf.Reset()
+	w = NewWriter(&buf)
+	require.NoError(t, w.WriteStatusLine(204))
+	require.NoError(t, w.WriteHeaders(headers.NewHeaders()))
+	require.NoError(t, w.Finish())
+	assert.True(t, w.KeepAlive())
+	assert.Equal(t, "HTTP/1.1 204 No Content\r\n\r\n", buf.String())
+}
+
+func TestWriteUnauthorizedWithoutChallenge(t *testing.T) {
+	var buf bytes.Buffer
+	w := NewWriter(&buf)
+	assert.Error(t, w.WriteUnauthorized())
+	assert.Empty(t, buf.String())
+	// nothing was written, another response can still be sent
+	require.NoError(t, w.WriteStatusLine(500))
+}
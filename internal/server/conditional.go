@@ -0,0 +1,27 @@
+package server
+
+import (
+	"time"
+
+	"github.com/P-H-Pancholi/httpfromtcp/internal/headers"
+	"github.com/P-H-Pancholi/httpfromtcp/internal/request"
+	"github.com/P-H-Pancholi/httpfromtcp/internal/response"
+)
+
+// CheckPreconditions evaluates the conditional headers of req against the
+// representation described by etag and modTime, and answers 304 Not
+// Modified or 412 Precondition Failed when they don't pass. h holds the
+// headers of the full response, a 304 keeps the validators and caching
+// fields from it. It reports whether a response was written, in which
+// case the handler is done.
+func CheckPreconditions(w *response.Writer, req *request.Request, h headers.Headers, etag string, modTime time.Time) bool {
+	switch req.EvaluatePreconditions(etag, modTime) {
+	case request.PreconditionNotModified:
+		w.WriteNotModified(h)
+		return true
+	case request.PreconditionFailed:
+		w.WritePreconditionFailed()
+		return true
+	}
+	return false
+}
@@ -0,0 +1,72 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"net"
+	"sync/atomic"
+	"time"
+)
+
+// connReader is the reader request.Reader reads the connection through.
+// While a handler runs and the request has been read completely, it reads
+// ahead in the background to notice the client closing the connection.
+type connReader struct {
+	conn net.Conn
+
+	// pending holds a byte read ahead in the background, it belongs to
+	// the next request
+	pending []byte
+	err     error
+
+	bgDone   chan struct{}
+	aborting atomic.Bool
+}
+
+func (cr *connReader) Read(p []byte) (int, error) {
+	if len(cr.pending) > 0 {
+		n := copy(p, cr.pending)
+		cr.pending = cr.pending[n:]
+		return n, nil
+	}
+	if cr.err != nil {
+		return 0, cr.err
+	}
+	return cr.conn.Read(p)
+}
+
+// startBackgroundRead waits for the next byte from the client and calls
+// cancel if the connection is closed instead
+func (cr *connReader) startBackgroundRead(cancel context.CancelFunc) {
+	cr.bgDone = make(chan struct{})
+	go func() {
+		defer close(cr.bgDone)
+		var b [1]byte
+		n, err := cr.conn.Read(b[:])
+		if n == 1 {
+			cr.pending = append(cr.pending, b[0])
+		}
+		if err != nil {
+			var ne net.Error
+			if cr.aborting.Load() && errors.As(err, &ne) && ne.Timeout() {
+				return
+			}
+			cr.err = err
+			cancel()
+		}
+	}()
+}
+
+// abortBackgroundRead stops a background read and waits for it to finish
+func (cr *connReader) abortBackgroundRead() {
+	if cr.bgDone == nil {
+		return
+	}
+	cr.aborting.Store(true)
+	// a deadline in the past unblocks the read
+	cr.conn.SetReadDeadline(time.Unix(1, 0))
+	<-cr.bgDone
+	cr.conn.SetReadDeadline(time.Time{})
+	cr.aborting.Store(false)
+	cr.bgDone = nil
+}
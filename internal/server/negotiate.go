@@ -0,0 +1,97 @@
+package server
+
+import (
+	"slices"
+	"strings"
+
+	"github.com/P-H-Pancholi/httpfromtcp/internal/headers"
+	"github.com/P-H-Pancholi/httpfromtcp/internal/request"
+	"github.com/P-H-Pancholi/httpfromtcp/internal/response"
+)
+
+// Offer describes one representation a handler can send. A field left
+// empty is not negotiated.
+type Offer struct {
+	// ContentType is a media type such as "text/html; charset=utf-8"
+	ContentType string
+	// Encoding is a content-coding such as "gzip", or "identity"
+	Encoding string
+	// Language is a language tag such as "en-GB"
+	Language string
+}
+
+// Negotiate picks the offer the Accept, Accept-Encoding and
+// Accept-Language headers of req weigh highest, earlier offers win ties.
+// The chosen offer's Content-Type, Content-Encoding and Content-Language
+// are set in h, along with a Vary header naming the fields that were
+// consulted. When no offer is acceptable it answers 406 Not Acceptable and
+// reports false, in which case the handler is done.
+func Negotiate(w *response.Writer, req *request.Request, h headers.Headers, offers ...Offer) (Offer, bool) {
+	var types, encodings, languages []headers.AcceptRange
+	var hasTypes, hasEncodings, hasLanguages bool
+	if v, ok := req.Headers.Get("Accept"); ok && strings.TrimSpace(v) != "" {
+		types, hasTypes = headers.ParseAccept(v), true
+	}
+	// an empty Accept-Encoding still means only identity is acceptable
+	if v, ok := req.Headers.Get("Accept-Encoding"); ok {
+		encodings, hasEncodings = headers.ParseAcceptList(v), true
+	}
+	if v, ok := req.Headers.Get("Accept-Language"); ok && strings.TrimSpace(v) != "" {
+		languages, hasLanguages = headers.ParseAcceptList(v), true
+	}
+
+	var vary []string
+	var best Offer
+	bestQ := 0.0
+	for _, offer := range offers {
+		q := 1.0
+		if offer.ContentType != "" {
+			vary = appendOnce(vary, "Accept")
+			if hasTypes {
+				q *= headers.MediaTypeQuality(types, offer.ContentType)
+			}
+		}
+		if offer.Encoding != "" {
+			vary = appendOnce(vary, "Accept-Encoding")
+			if hasEncodings {
+				q *= headers.EncodingQuality(encodings, offer.Encoding)
+			}
+		}
+		if offer.Language != "" {
+			vary = appendOnce(vary, "Accept-Language")
+			if hasLanguages {
+				q *= headers.LanguageQuality(languages, offer.Language)
+			}
+		}
+		if q > bestQ {
+			best, bestQ = offer, q
+		}
+	}
+
+	if len(offers) > 0 && bestQ == 0 {
+		w.WriteNotAcceptable(strings.Join(vary, ", "))
+		return Offer{}, false
+	}
+	for _, field := range vary {
+		if !h.HasToken("Vary", field) {
+			h.Set("Vary", field)
+		}
+	}
+	if best.ContentType != "" {
+		h.Override("Content-Type", best.ContentType)
+	}
+	if best.Encoding != "" && !strings.EqualFold(best.Encoding, "identity") {
+		h.Override("Content-Encoding", best.Encoding)
+	}
+	if best.Language != "" {
+		h.Override("Content-Language", best.Language)
+	}
+	return best, true
+}
+
+func appendOnce(fields []string, field string) []string {
+	if slices.Contains(fields, field) {
+		return fields
+	}
+	return append(fields, field)
+}
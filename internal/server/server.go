@@ -1,10 +1,17 @@
 package server
 
 import (
+	"context"
+	"crypto/tls"
+	"errors"
 	"fmt"
+	"io"
 	"log"
 	"net"
+	"os"
+	"sync"
 	"sync/atomic"
+	"time"
 
 	"github.com/P-H-Pancholi/httpfromtcp/internal/request"
 	"github.com/P-H-Pancholi/httpfromtcp/internal/response"
@@ -12,34 +19,176 @@ import (
 
 type Handler func(w *response.Writer, req *request.Request)
 
+// DefaultIdleTimeout is how long a connection waits for its next request
+// unless WithIdleTimeout says otherwise
+const DefaultIdleTimeout = 2 * time.Minute
+
 // Server is an HTTP 1.1 server
 type Server struct {
 	handler  Handler
 	listener net.Listener
 	closed   atomic.Bool
+	// connID numbers the accepted connections
+	connID atomic.Uint64
+	// ctx is cancelled when the server is closed
+	ctx    context.Context
+	cancel context.CancelFunc
+	// conns holds the open connections, true for the ones waiting for
+	// their next request
+	mu    sync.Mutex
+	conns map[net.Conn]bool
+
+	streamBodies bool
+	limits       request.Limits
+	strictPaths  bool
+	timeout      time.Duration
+	idleTimeout  time.Duration
+	tlsConfig    *tls.Config
+	decompress   bool
+	// methods are the request methods the handler implements
+	methods map[string]bool
+}
+
+// errNotImplemented is returned for requests whose method wasn't
+// registered with WithMethods
+var errNotImplemented = errors.New("method not implemented")
+
+// Option configures optional Server behaviour
+type Option func(*Server)
+
+// WithStreamingBodies makes the server call the handler as soon as the
+// request headers are read. The handler reads the body from the connection
+// through req.BodyReader instead of getting it buffered in req.Body.
+// Bodies of requests with Expect: 100-continue are always streamed, so
+// the handler can refuse them before the client sends them.
+func WithStreamingBodies() Option {
+	return func(s *Server) {
+		s.streamBodies = true
+	}
+}
+
+// WithLimits replaces request.DefaultLimits for requests read by the server
+func WithLimits(limits request.Limits) Option {
+	return func(s *Server) {
+		s.limits = limits
+	}
+}
+
+// WithStrictPaths answers 400 to requests whose path holds an encoded slash
+// or NUL byte instead of decoding them
+func WithStrictPaths() Option {
+	return func(s *Server) {
+		s.strictPaths = true
+	}
+}
+
+// WithRequestTimeout sets a deadline on the context of every request,
+// counted from when its headers have been read
+func WithRequestTimeout(d time.Duration) Option {
+	return func(s *Server) {
+		s.timeout = d
+	}
+}
+
+// WithIdleTimeout limits how long a connection waits for the next request
+// and for its headers to arrive, a client that takes longer is
+// disconnected. Zero disables the limit.
+func WithIdleTimeout(d time.Duration) Option {
+	return func(s *Server) {
+		s.idleTimeout = d
+	}
 }
 
-func Serve(port int, handler Handler) (*Server, error) {
+// WithMethods sets the request methods the handler implements, requests
+// with any other method are answered with 501 Not Implemented. By default
+// the request.StandardMethods are accepted.
+func WithMethods(methods ...string) Option {
+	return func(s *Server) {
+		s.methods = make(map[string]bool, len(methods))
+		for _, m := range methods {
+			s.methods[m] = true
+		}
+	}
+}
+
+// WithDecompression makes the server decode gzip and deflate request
+// bodies before handing them to the handler. Requests with other content
+// codings are answered with 415 Unsupported Media Type.
+func WithDecompression() Option {
+	return func(s *Server) {
+		s.decompress = true
+	}
+}
+
+// WithTLS serves HTTPS using config, which needs at least one certificate
+func WithTLS(config *tls.Config) Option {
+	return func(s *Server) {
+		s.tlsConfig = config
+	}
+}
+
+func Serve(port int, handler Handler, opts ...Option) (*Server, error) {
 	listener, err := net.Listen("tcp", fmt.Sprintf(":%d", port))
 	if err != nil {
 		return nil, err
 	}
 	s := &Server{
-		handler:  handler,
-		listener: listener,
+		handler:     handler,
+		listener:    listener,
+		limits:      request.DefaultLimits,
+		idleTimeout: DefaultIdleTimeout,
+		conns:       map[net.Conn]bool{},
+	}
+	s.ctx, s.cancel = context.WithCancel(context.Background())
+	WithMethods(request.StandardMethods...)(s)
+	for _, opt := range opts {
+		opt(s)
+	}
+	if s.tlsConfig != nil {
+		s.listener = tls.NewListener(listener, s.tlsConfig)
 	}
 	go s.listen()
 	return s, nil
 }
 
+// Close stops accepting connections, closes the ones waiting for a
+// request and cancels the context of the requests being handled. Those
+// connections are closed once their response is written.
 func (s *Server) Close() error {
 	s.closed.Store(true)
+	s.cancel()
+	s.mu.Lock()
+	for conn, idle := range s.conns {
+		if idle {
+			conn.Close()
+		}
+	}
+	s.mu.Unlock()
 	if s.listener != nil {
 		return s.listener.Close()
 	}
 	return nil
 }
 
+// setIdle records whether conn is waiting for its next request. It
+// reports false when the server has been closed and an idle connection
+// should be closed instead.
+func (s *Server) setIdle(conn net.Conn, idle bool) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if idle && s.closed.Load() {
+		return false
+	}
+	s.conns[conn] = idle
+	return true
+}
+
+func (s *Server) removeConn(conn net.Conn) {
+	s.mu.Lock()
+	delete(s.conns, conn)
+	s.mu.Unlock()
+}
+
 func (s *Server) listen() {
 	for {
 		conn, err := s.listener.Accept()
@@ -54,16 +203,174 @@ func (s *Server) listen() {
 	}
 }
 
+// handle serves requests on the connection until the client or the handler
+// asks for it to be closed. Pipelined requests are answered in the order
+// they were received.
 func (s *Server) handle(conn net.Conn) {
 	defer conn.Close()
-	w := response.NewWriter(conn)
-	req, err := request.RequestFromReader(conn)
-	if err != nil {
-		w.WriteStatusLine(400)
-		body := []byte(fmt.Sprintf("Error parsing request: %v", err))
-		w.WriteHeaders(response.GetDefaultHeaders(len(body)))
-		w.WriteBody(body)
+	defer s.removeConn(conn)
+	if !s.setIdle(conn, true) {
 		return
 	}
-	s.handler(&w, req)
+	ctx, cancel := context.WithCancel(s.ctx)
+	defer cancel()
+	connID := s.connID.Add(1)
+	var tlsState *tls.ConnectionState
+	if tlsConn, ok := conn.(*tls.Conn); ok {
+		if err := tlsConn.HandshakeContext(ctx); err != nil {
+			log.Printf("TLS handshake with %s failed: %v", conn.RemoteAddr(), err)
+			return
+		}
+		state := tlsConn.ConnectionState()
+		tlsState = &state
+	}
+	cr := &connReader{conn: conn}
+	reader := request.NewReader(cr)
+	defer reader.Release()
+	reader.Limits = s.limits
+	reader.StrictPaths = s.strictPaths
+	for seq := 1; ; seq++ {
+		if !s.setIdle(conn, true) {
+			return
+		}
+		if s.idleTimeout > 0 {
+			conn.SetReadDeadline(time.Now().Add(s.idleTimeout))
+		}
+		req, err := reader.ReadRequestHeader()
+		if err != nil {
+			// an idle client that timed out or a connection closed by
+			// Close gets no answer
+			if !errors.Is(err, io.EOF) && !errors.Is(err, os.ErrDeadlineExceeded) && !s.closed.Load() {
+				writeParseError(conn, err)
+			}
+			return
+		}
+		conn.SetReadDeadline(time.Time{})
+		s.setIdle(conn, false)
+		req.RemoteAddr = conn.RemoteAddr()
+		req.LocalAddr = conn.LocalAddr()
+		req.ConnID = connID
+		req.Seq = seq
+		req.TLS = tlsState
+		if !s.methods[req.RequestLine.Method] {
+			writeParseError(conn, fmt.Errorf("%w: %q", errNotImplemented, req.RequestLine.Method))
+			return
+		}
+
+		w := response.NewWriter(conn)
+		w.SetRequestVersion(req.RequestLine.HttpVersion)
+		w.SetRequestMethod(req.RequestLine.Method)
+		expectContinue, err := req.ExpectsContinue()
+		if err != nil {
+			writeParseError(conn, err)
+			return
+		}
+		keepAlive := req.KeepAlive() && !s.closed.Load()
+		w.SetKeepAlive(keepAlive)
+		if expectContinue && req.State != request.Done {
+			// the client holds the body back until it gets 100 Continue.
+			// If the handler answers without asking for the body, the
+			// client may or may not send it anyway, so the connection
+			// can't be reused.
+			w.SetKeepAlive(false)
+			req.OnBodyRead(func() {
+				if w.WriteContinue() == nil {
+					w.SetKeepAlive(keepAlive)
+				}
+			})
+		}
+		if s.decompress {
+			if err := req.DecompressBody(); err != nil {
+				writeParseError(conn, err)
+				return
+			}
+		}
+		// reading the body ahead would send 100 Continue before the
+		// handler could reject the request, so a client that waits for
+		// it gets its body streamed like WithStreamingBodies does
+		if !s.streamBodies && !expectContinue {
+			if _, err := req.ReadBody(); err != nil {
+				writeParseError(conn, err)
+				return
+			}
+		}
+
+		s.serveRequest(ctx, cr, &w, req)
+		w.Finish()
+		if !w.KeepAlive() {
+			return
+		}
+		// skip whatever the handler left of the body to get to the
+		// next request
+		if err := req.BodyReader().Close(); err != nil {
+			return
+		}
+	}
+}
+
+// serveRequest runs the handler with a context that is cancelled when the
+// client goes away, the server is closed or the request times out
+func (s *Server) serveRequest(ctx context.Context, cr *connReader, w *response.Writer, req *request.Request) {
+	var cancel context.CancelFunc
+	if s.timeout > 0 {
+		ctx, cancel = context.WithTimeout(ctx, s.timeout)
+	} else {
+		ctx, cancel = context.WithCancel(ctx)
+	}
+	defer cancel()
+	req = req.WithContext(ctx)
+
+	// with the request read completely, the next read either starts the
+	// next request or tells that the client closed the connection. A
+	// streamed body is still being read by the handler, so it can't be
+	// watched.
+	if req.State == request.Done {
+		cr.startBackgroundRead(cancel)
+		defer cr.abortBackgroundRead()
+	}
+	s.handler(w, req)
+	if req.MultipartForm != nil {
+		req.MultipartForm.RemoveAll()
+	}
+}
+
+// writeParseError answers a request that couldn't be parsed, the
+// connection is closed afterwards since the framing of anything that
+// follows is unknown
+func writeParseError(conn net.Conn, err error) {
+	log.Printf("Error parsing request from %s: %v", conn.RemoteAddr(), err)
+	w := response.NewWriter(conn)
+	w.SetKeepAlive(false)
+	w.WriteStatusLine(statusForError(err))
+	body := []byte(fmt.Sprintf("Error parsing request: %v", err))
+	h := response.GetDefaultHeaders(len(body))
+	if errors.Is(err, request.ErrUnsupportedContentEncoding) {
+		// tell the client which codings it can use instead
+		h.Set("Accept-Encoding", "gzip, deflate")
+	}
+	w.WriteHeaders(h)
+	w.WriteBody(body)
+}
+
+func statusForError(err error) response.StatusCode {
+	switch {
+	case errors.Is(err, request.ErrRequestLineTooLong):
+		return 414
+	case errors.Is(err, request.ErrHeadersTooLarge),
+		errors.Is(err, request.ErrTooManyHeaders):
+		return 431
+	case errors.Is(err, request.ErrBodyTooLarge):
+		return 413
+	case errors.Is(err, request.ErrUnsupportedContentEncoding):
+		return 415
+	case errors.Is(err, request.ErrUnsupportedExpectation):
+		return 417
+	case errors.Is(err, request.ErrUnsupportedTransferEncoding),
+		errors.Is(err, errNotImplemented):
+		return 501
+	case errors.Is(err, request.ErrUnsupportedVersion):
+		return 505
+	default:
+		return 400
+	}
 }
@@ -0,0 +1,693 @@
+package server
+
+import (
+	"bufio"
+	"compress/gzip"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"fmt"
+	"io"
+	"math/big"
+	"net"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/P-H-Pancholi/httpfromtcp/internal/request"
+	"github.com/P-H-Pancholi/httpfromtcp/internal/response"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func echoTarget(w *response.Writer, req *request.Request) {
+	body := []byte(req.RequestLine.RequestTarget)
+	w.WriteStatusLine(200)
+	w.WriteHeaders(response.GetDefaultHeaders(len(body)))
+	w.WriteBody(body)
+}
+
+func startServer(t *testing.T, handler Handler, opts ...Option) net.Conn {
+	t.Helper()
+	s, err := Serve(0, handler, opts...)
+	require.NoError(t, err)
+	t.Cleanup(func() { s.Close() })
+
+	conn, err := net.Dial("tcp", s.listener.Addr().String())
+	require.NoError(t, err)
+	t.Cleanup(func() { conn.Close() })
+	return conn
+}
+
+type testResponse struct {
+	statusLine string
+	headers    map[string]string
+	body       string
+}
+
+// readResponse reads a single Content-Length delimited response
+func readResponse(t *testing.T, br *bufio.Reader) testResponse {
+	t.Helper()
+	statusLine, err := br.ReadString('\n')
+	require.NoError(t, err)
+	resp := testResponse{
+		statusLine: strings.TrimRight(statusLine, "\r\n"),
+		headers:    map[string]string{},
+	}
+	for {
+		line, err := br.ReadString('\n')
+		require.NoError(t, err)
+		line = strings.TrimRight(line, "\r\n")
+		if line == "" {
+			break
+		}
+		key, value, _ := strings.Cut(line, ":")
+		resp.headers[strings.ToLower(key)] = strings.TrimSpace(value)
+	}
+	n, err := strconv.Atoi(resp.headers["content-length"])
+	require.NoError(t, err)
+	body := make([]byte, n)
+	_, err = io.ReadFull(br, body)
+	require.NoError(t, err)
+	resp.body = string(body)
+	return resp
+}
+
+func TestPersistentConnection(t *testing.T) {
+	conn := startServer(t, echoTarget)
+	br := bufio.NewReader(conn)
+
+	_, err := conn.Write([]byte("GET /one HTTP/1.1\r\nHost: localhost\r\n\r\n"))
+	require.NoError(t, err)
+	resp := readResponse(t, br)
+	assert.Equal(t, "HTTP/1.1 200 OK", resp.statusLine)
+	assert.Equal(t, "/one", resp.body)
+	assert.NotContains(t, resp.headers, "connection")
+
+	// Test: pipelined requests are answered in order
+	_, err = conn.Write([]byte("GET /two HTTP/1.1\r\nHost: localhost\r\n\r\n" +
+		"POST /three HTTP/1.1\r\nHost: localhost\r\nContent-Length: 3\r\n\r\nabc" +
+		"GET /four HTTP/1.1\r\nHost: localhost\r\nConnection: close\r\n\r\n"))
+	require.NoError(t, err)
+	assert.Equal(t, "/two", readResponse(t, br).body)
+	assert.Equal(t, "/three", readResponse(t, br).body)
+	resp = readResponse(t, br)
+	assert.Equal(t, "/four", resp.body)
+	assert.Equal(t, "close", resp.headers["connection"])
+
+	_, err = br.ReadByte()
+	assert.ErrorIs(t, err, io.EOF)
+}
+
+func TestHandlerClosesConnection(t *testing.T) {
+	conn := startServer(t, func(w *response.Writer, req *request.Request) {
+		h := response.GetDefaultHeaders(0)
+		h.Override("Connection", "close")
+		w.WriteStatusLine(200)
+		w.WriteHeaders(h)
+	})
+	br := bufio.NewReader(conn)
+
+	_, err := conn.Write([]byte("GET / HTTP/1.1\r\nHost: localhost\r\n\r\n" +
+		"GET / HTTP/1.1\r\nHost: localhost\r\n\r\n"))
+	require.NoError(t, err)
+	resp := readResponse(t, br)
+	assert.Equal(t, "close", resp.headers["connection"])
+
+	// the unread second request may turn the close into a reset
+	_, err = br.ReadByte()
+	assert.Error(t, err)
+}
+
+func TestBadRequestClosesConnection(t *testing.T) {
+	conn := startServer(t, echoTarget)
+	br := bufio.NewReader(conn)
+
+	_, err := conn.Write([]byte("GET /\r\n\r\n"))
+	require.NoError(t, err)
+	resp := readResponse(t, br)
+	assert.Equal(t, "HTTP/1.1 400 Bad Request", resp.statusLine)
+	assert.Equal(t, "close", resp.headers["connection"])
+
+	_, err = br.ReadByte()
+	assert.Error(t, err)
+}
+
+func TestStreamingBodies(t *testing.T) {
+	conn := startServer(t, func(w *response.Writer, req *request.Request) {
+		assert.Empty(t, req.Body)
+		// only read part of the body, the server skips the rest
+		p := make([]byte, 3)
+		n, _ := io.ReadFull(req.BodyReader(), p)
+		w.WriteStatusLine(200)
+		w.WriteHeaders(response.GetDefaultHeaders(n))
+		w.WriteBody(p[:n])
+	}, WithStreamingBodies())
+	br := bufio.NewReader(conn)
+
+	_, err := conn.Write([]byte("POST / HTTP/1.1\r\nHost: localhost\r\nTransfer-Encoding: chunked\r\n\r\n" +
+		"5\r\nhello\r\n0\r\n\r\n" +
+		"POST / HTTP/1.1\r\nHost: localhost\r\nContent-Length: 5\r\n\r\nworld"))
+	require.NoError(t, err)
+	assert.Equal(t, "hel", readResponse(t, br).body)
+	assert.Equal(t, "wor", readResponse(t, br).body)
+}
+
+func TestUnknownTransferCoding(t *testing.T) {
+	conn := startServer(t, echoBody)
+	_, err := conn.Write([]byte("POST / HTTP/1.1\r\nHost: localhost\r\nTransfer-Encoding: gzip, chunked\r\n\r\n"))
+	require.NoError(t, err)
+	resp := readResponse(t, bufio.NewReader(conn))
+	assert.Equal(t, "HTTP/1.1 501 Not Implemented", resp.statusLine)
+	assert.Equal(t, "close", resp.headers["connection"])
+}
+
+func TestLimitStatusCodes(t *testing.T) {
+	limits := request.Limits{
+		MaxRequestLineBytes: 32,
+		MaxHeaderBytes:      64,
+		MaxHeaderCount:      4,
+		MaxBodyBytes:        8,
+	}
+	tests := []struct {
+		name       string
+		request    string
+		statusLine string
+	}{
+		{
+			name:       "request line",
+			request:    "GET /" + strings.Repeat("a", 64) + " HTTP/1.1\r\nHost: localhost\r\n\r\n",
+			statusLine: "HTTP/1.1 414 URI Too Long",
+		},
+		{
+			name:       "header bytes",
+			request:    "GET / HTTP/1.1\r\nHost: localhost\r\nX-Big: " + strings.Repeat("a", 64) + "\r\n\r\n",
+			statusLine: "HTTP/1.1 431 Request Header Fields Too Large",
+		},
+		{
+			name:       "header count",
+			request:    "GET / HTTP/1.1\r\nHost: localhost\r\nA: 1\r\nB: 2\r\nC: 3\r\nD: 4\r\n\r\n",
+			statusLine: "HTTP/1.1 431 Request Header Fields Too Large",
+		},
+		{
+			name:       "body",
+			request:    "POST / HTTP/1.1\r\nHost: localhost\r\nContent-Length: 9\r\n\r\n123456789",
+			statusLine: "HTTP/1.1 413 Content Too Large",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			conn := startServer(t, echoTarget, WithLimits(limits))
+			_, err := conn.Write([]byte(tt.request))
+			require.NoError(t, err)
+			resp := readResponse(t, bufio.NewReader(conn))
+			assert.Equal(t, tt.statusLine, resp.statusLine)
+		})
+	}
+}
+
+func readLine(t *testing.T, br *bufio.Reader) string {
+	t.Helper()
+	line, err := br.ReadString('\n')
+	require.NoError(t, err)
+	return strings.TrimRight(line, "\r\n")
+}
+
+func echoBody(w *response.Writer, req *request.Request) {
+	body, err := io.ReadAll(req.BodyReader())
+	if err != nil {
+		return
+	}
+	w.WriteStatusLine(200)
+	w.WriteHeaders(response.GetDefaultHeaders(len(body)))
+	w.WriteBody(body)
+}
+
+func TestExpectContinue(t *testing.T) {
+	for _, opts := range [][]Option{nil, {WithStreamingBodies()}} {
+		conn := startServer(t, echoBody, opts...)
+		br := bufio.NewReader(conn)
+
+		_, err := conn.Write([]byte("POST / HTTP/1.1\r\nHost: localhost\r\nExpect: 100-continue\r\nContent-Length: 5\r\n\r\n"))
+		require.NoError(t, err)
+		// the body is only sent after the interim response
+		assert.Equal(t, "HTTP/1.1 100 Continue", readLine(t, br))
+		assert.Equal(t, "", readLine(t, br))
+		_, err = conn.Write([]byte("hello"))
+		require.NoError(t, err)
+		resp := readResponse(t, br)
+		assert.Equal(t, "HTTP/1.1 200 OK", resp.statusLine)
+		assert.Equal(t, "hello", resp.body)
+		assert.NotContains(t, resp.headers, "connection")
+	}
+}
+
+func TestExpectContinueRejected(t *testing.T) {
+	// the buffered mode must not read the body ahead of the handler either
+	for _, opts := range [][]Option{nil, {WithStreamingBodies()}} {
+		conn := startServer(t, func(w *response.Writer, req *request.Request) {
+			// answer without looking at the body
+			w.WriteStatusLine(413)
+			w.WriteHeaders(response.GetDefaultHeaders(0))
+		}, opts...)
+		br := bufio.NewReader(conn)
+
+		_, err := conn.Write([]byte("POST / HTTP/1.1\r\nHost: localhost\r\nExpect: 100-continue\r\nContent-Length: 5\r\n\r\n"))
+		require.NoError(t, err)
+		resp := readResponse(t, br)
+		assert.Equal(t, "HTTP/1.1 413 Content Too Large", resp.statusLine)
+		assert.Equal(t, "close", resp.headers["connection"])
+		_, err = br.ReadByte()
+		assert.Error(t, err)
+	}
+}
+
+func TestUnknownExpectation(t *testing.T) {
+	conn := startServer(t, echoBody)
+	br := bufio.NewReader(conn)
+
+	_, err := conn.Write([]byte("POST / HTTP/1.1\r\nHost: localhost\r\nExpect: teapot\r\nContent-Length: 5\r\n\r\n"))
+	require.NoError(t, err)
+	resp := readResponse(t, br)
+	assert.Equal(t, "HTTP/1.1 417 Expectation Failed", resp.statusLine)
+}
+
+func TestHTTPVersions(t *testing.T) {
+	conn := startServer(t, echoTarget)
+	br := bufio.NewReader(conn)
+	_, err := conn.Write([]byte("GET /old HTTP/1.0\r\nConnection: keep-alive\r\n\r\n"))
+	require.NoError(t, err)
+	resp := readResponse(t, br)
+	assert.Equal(t, "/old", resp.body)
+	assert.Equal(t, "keep-alive", resp.headers["connection"])
+
+	// Test: HTTP/1.0 closes by default
+	_, err = conn.Write([]byte("GET /old HTTP/1.0\r\n\r\n"))
+	require.NoError(t, err)
+	resp = readResponse(t, br)
+	assert.Equal(t, "close", resp.headers["connection"])
+	_, err = br.ReadByte()
+	assert.ErrorIs(t, err, io.EOF)
+
+	conn = startServer(t, echoTarget)
+	_, err = conn.Write([]byte("GET / HTTP/2.0\r\nHost: localhost\r\n\r\n"))
+	require.NoError(t, err)
+	resp = readResponse(t, bufio.NewReader(conn))
+	assert.Equal(t, "HTTP/1.1 505 HTTP Version Not Supported", resp.statusLine)
+}
+
+func TestContextCancelledOnDisconnect(t *testing.T) {
+	done := make(chan error, 1)
+	conn := startServer(t, func(w *response.Writer, req *request.Request) {
+		select {
+		case <-req.Context().Done():
+			done <- req.Context().Err()
+		case <-time.After(5 * time.Second):
+			done <- nil
+		}
+	})
+	_, err := conn.Write([]byte("GET / HTTP/1.1\r\nHost: localhost\r\n\r\n"))
+	require.NoError(t, err)
+	// give the handler time to start before going away
+	time.Sleep(50 * time.Millisecond)
+	conn.Close()
+	assert.ErrorIs(t, <-done, context.Canceled)
+}
+
+func TestContextTimeout(t *testing.T) {
+	conn := startServer(t, func(w *response.Writer, req *request.Request) {
+		<-req.Context().Done()
+		body := []byte(req.Context().Err().Error())
+		w.WriteStatusLine(200)
+		w.WriteHeaders(response.GetDefaultHeaders(len(body)))
+		w.WriteBody(body)
+	}, WithRequestTimeout(20*time.Millisecond))
+	br := bufio.NewReader(conn)
+
+	// Test: pipelined requests still work with the background read
+	_, err := conn.Write([]byte("GET / HTTP/1.1\r\nHost: localhost\r\n\r\n" +
+		"GET / HTTP/1.1\r\nHost: localhost\r\n\r\n"))
+	require.NoError(t, err)
+	assert.Equal(t, context.DeadlineExceeded.Error(), readResponse(t, br).body)
+	assert.Equal(t, context.DeadlineExceeded.Error(), readResponse(t, br).body)
+}
+
+func TestContextCancelledOnClose(t *testing.T) {
+	started := make(chan struct{})
+	done := make(chan error, 1)
+	s, err := Serve(0, func(w *response.Writer, req *request.Request) {
+		close(started)
+		<-req.Context().Done()
+		done <- req.Context().Err()
+	})
+	require.NoError(t, err)
+	conn, err := net.Dial("tcp", s.listener.Addr().String())
+	require.NoError(t, err)
+	defer conn.Close()
+
+	_, err = conn.Write([]byte("GET / HTTP/1.1\r\nHost: localhost\r\n\r\n"))
+	require.NoError(t, err)
+	<-started
+	s.Close()
+	assert.ErrorIs(t, <-done, context.Canceled)
+}
+
+func TestConnectionMetadata(t *testing.T) {
+	echoConn := func(w *response.Writer, req *request.Request) {
+		body := []byte(fmt.Sprintf("%s %s %d %d %v", req.RemoteAddr, req.LocalAddr, req.ConnID, req.Seq, req.TLS != nil))
+		w.WriteStatusLine(200)
+		w.WriteHeaders(response.GetDefaultHeaders(len(body)))
+		w.WriteBody(body)
+	}
+	s, err := Serve(0, echoConn)
+	require.NoError(t, err)
+	defer s.Close()
+
+	var connIDs []string
+	for range 2 {
+		conn, err := net.Dial("tcp", s.listener.Addr().String())
+		require.NoError(t, err)
+		defer conn.Close()
+		br := bufio.NewReader(conn)
+
+		_, err = conn.Write([]byte("GET / HTTP/1.1\r\nHost: localhost\r\n\r\n" +
+			"GET / HTTP/1.1\r\nHost: localhost\r\n\r\n"))
+		require.NoError(t, err)
+		for seq := 1; seq <= 2; seq++ {
+			fields := strings.Fields(readResponse(t, br).body)
+			require.Len(t, fields, 5)
+			assert.Equal(t, conn.LocalAddr().String(), fields[0])
+			assert.Equal(t, conn.RemoteAddr().String(), fields[1])
+			assert.Equal(t, strconv.Itoa(seq), fields[3])
+			assert.Equal(t, "false", fields[4])
+			if seq == 1 {
+				connIDs = append(connIDs, fields[2])
+			} else {
+				assert.Equal(t, connIDs[len(connIDs)-1], fields[2], "same connection")
+			}
+		}
+	}
+	assert.NotEqual(t, connIDs[0], connIDs[1])
+}
+
+func TestTLS(t *testing.T) {
+	cert := selfSignedCert(t)
+	// the handler runs on the server's goroutine, the state is checked
+	// on the test goroutine
+	states := make(chan *tls.ConnectionState, 1)
+	s, err := Serve(0, func(w *response.Writer, req *request.Request) {
+		states <- req.TLS
+		var body []byte
+		if req.TLS != nil {
+			body = []byte(tls.VersionName(req.TLS.Version))
+		}
+		w.WriteStatusLine(200)
+		w.WriteHeaders(response.GetDefaultHeaders(len(body)))
+		w.WriteBody(body)
+	}, WithTLS(&tls.Config{Certificates: []tls.Certificate{cert}}))
+	require.NoError(t, err)
+	defer s.Close()
+
+	conn, err := tls.Dial("tcp", s.listener.Addr().String(), &tls.Config{InsecureSkipVerify: true})
+	require.NoError(t, err)
+	defer conn.Close()
+	_, err = conn.Write([]byte("GET / HTTP/1.1\r\nHost: localhost\r\n\r\n"))
+	require.NoError(t, err)
+	resp := readResponse(t, bufio.NewReader(conn))
+	require.NotNil(t, <-states)
+	assert.Equal(t, "HTTP/1.1 200 OK", resp.statusLine)
+	assert.Equal(t, tls.VersionName(conn.ConnectionState().Version), resp.body)
+}
+
+func selfSignedCert(t *testing.T) tls.Certificate {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "localhost"},
+		DNSNames:     []string{"localhost"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	require.NoError(t, err)
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}
+}
+
+func TestDecompression(t *testing.T) {
+	var buf strings.Builder
+	zw := gzip.NewWriter(&buf)
+	zw.Write([]byte("hello world"))
+	zw.Close()
+	body := buf.String()
+	req := "POST / HTTP/1.1\r\nHost: localhost\r\nContent-Encoding: gzip\r\nContent-Length: " +
+		strconv.Itoa(len(body)) + "\r\n\r\n" + body
+
+	for _, opts := range [][]Option{{WithDecompression()}, {WithDecompression(), WithStreamingBodies()}} {
+		conn := startServer(t, echoBody, opts...)
+		br := bufio.NewReader(conn)
+		_, err := conn.Write([]byte(req + req))
+		require.NoError(t, err)
+		assert.Equal(t, "hello world", readResponse(t, br).body)
+		assert.Equal(t, "hello world", readResponse(t, br).body)
+	}
+
+	// Test: bodies are left alone without the option
+	conn := startServer(t, echoBody)
+	_, err := conn.Write([]byte(req))
+	require.NoError(t, err)
+	assert.Equal(t, body, readResponse(t, bufio.NewReader(conn)).body)
+
+	// Test: unsupported coding
+	conn = startServer(t, echoBody, WithDecompression())
+	_, err = conn.Write([]byte("POST / HTTP/1.1\r\nHost: localhost\r\nContent-Encoding: br\r\nContent-Length: 4\r\n\r\ndata"))
+	require.NoError(t, err)
+	resp := readResponse(t, bufio.NewReader(conn))
+	assert.Equal(t, "HTTP/1.1 415 Unsupported Media Type", resp.statusLine)
+	assert.Equal(t, "gzip, deflate", resp.headers["accept-encoding"])
+
+	// Test: decoded body over the limit
+	limits := request.DefaultLimits
+	limits.MaxDecompressedBytes = 5
+	conn = startServer(t, echoBody, WithDecompression(), WithLimits(limits))
+	_, err = conn.Write([]byte(req))
+	require.NoError(t, err)
+	resp = readResponse(t, bufio.NewReader(conn))
+	assert.Equal(t, "HTTP/1.1 413 Content Too Large", resp.statusLine)
+}
+
+func TestMethodNotImplemented(t *testing.T) {
+	// Test: standard methods are accepted by default
+	conn := startServer(t, echoTarget)
+	br := bufio.NewReader(conn)
+	_, err := conn.Write([]byte("DELETE /a HTTP/1.1\r\nHost: localhost\r\n\r\n" +
+		"PROPFIND /b HTTP/1.1\r\nHost: localhost\r\n\r\n"))
+	require.NoError(t, err)
+	assert.Equal(t, "HTTP/1.1 200 OK", readResponse(t, br).statusLine)
+	resp := readResponse(t, br)
+	assert.Equal(t, "HTTP/1.1 501 Not Implemented", resp.statusLine)
+	assert.Equal(t, "close", resp.headers["connection"])
+
+	// Test: only the registered methods are accepted
+	for method, status := range map[string]string{
+		"GET":      "HTTP/1.1 200 OK",
+		"PROPFIND": "HTTP/1.1 200 OK",
+		"POST":     "HTTP/1.1 501 Not Implemented",
+	} {
+		conn = startServer(t, echoTarget, WithMethods(request.MethodGet, "PROPFIND"))
+		_, err = conn.Write([]byte(method + " / HTTP/1.1\r\nHost: localhost\r\nContent-Length: 0\r\n\r\n"))
+		require.NoError(t, err)
+		assert.Equal(t, status, readResponse(t, bufio.NewReader(conn)).statusLine, method)
+	}
+}
+
+func TestHostRequired(t *testing.T) {
+	conn := startServer(t, echoTarget)
+	_, err := conn.Write([]byte("GET / HTTP/1.1\r\n\r\n"))
+	require.NoError(t, err)
+	resp := readResponse(t, bufio.NewReader(conn))
+	assert.Equal(t, "HTTP/1.1 400 Bad Request", resp.statusLine)
+	assert.Contains(t, resp.body, "missing host header")
+}
+
+func TestVirtualHosts(t *testing.T) {
+	named := func(name string) Handler {
+		return func(w *response.Writer, req *request.Request) {
+			body := []byte(name + " " + req.Path())
+			w.WriteStatusLine(200)
+			w.WriteHeaders(response.GetDefaultHeaders(len(body)))
+			w.WriteBody(body)
+		}
+	}
+	vh := NewVirtualHosts(named("default"))
+	vh.Add("api.example.test", named("api"))
+	vh.Add("Static.Example.Test", named("static"))
+	vh.Add("static.example.test:8080", named("static-8080"))
+
+	conn := startServer(t, vh.Handle)
+	br := bufio.NewReader(conn)
+	for host, want := range map[string]string{
+		"api.example.test":         "api /x",
+		"API.example.test:42069":   "api /x",
+		"static.example.test":      "static /x",
+		"static.example.test:8080": "static-8080 /x",
+		"other.example.test":       "default /x",
+		"localhost":                "default /x",
+	} {
+		_, err := conn.Write([]byte("GET /x HTTP/1.1\r\nHost: " + host + "\r\n\r\n"))
+		require.NoError(t, err)
+		assert.Equal(t, want, readResponse(t, br).body, host)
+	}
+
+	// Test: without a fallback unknown hosts get 404
+	conn = startServer(t, NewVirtualHosts(nil).Handle)
+	_, err := conn.Write([]byte("GET / HTTP/1.1\r\nHost: a.test\r\n\r\n"))
+	require.NoError(t, err)
+	assert.Equal(t, "HTTP/1.1 404 Not Found", readResponse(t, bufio.NewReader(conn)).statusLine)
+}
+
+func TestCheckPreconditions(t *testing.T) {
+	const etag = `"v1"`
+	conn := startServer(t, func(w *response.Writer, req *request.Request) {
+		body := []byte("cached page")
+		h := response.GetDefaultHeaders(len(body))
+		h.Override("ETag", etag)
+		if CheckPreconditions(w, req, h, etag, time.Time{}) {
+			return
+		}
+		w.WriteStatusLine(200)
+		w.WriteHeaders(h)
+		w.WriteBody(body)
+	})
+	br := bufio.NewReader(conn)
+
+	_, err := conn.Write([]byte("GET / HTTP/1.1\r\nHost: localhost\r\nIf-None-Match: \"v1\"\r\n\r\n" +
+		"PUT / HTTP/1.1\r\nHost: localhost\r\nIf-Match: \"v0\"\r\nContent-Length: 0\r\n\r\n" +
+		"GET / HTTP/1.1\r\nHost: localhost\r\nIf-None-Match: \"v0\"\r\n\r\n"))
+	require.NoError(t, err)
+
+	// the 304 has no body, so the next response follows right after it
+	assert.Equal(t, "HTTP/1.1 304 Not Modified", readLine(t, br))
+	fields := map[string]string{}
+	for line := readLine(t, br); line != ""; line = readLine(t, br) {
+		key, value, _ := strings.Cut(line, ": ")
+		fields[key] = value
+	}
+	assert.Equal(t, etag, fields["etag"])
+	assert.NotContains(t, fields, "connection")
+
+	assert.Equal(t, "HTTP/1.1 412 Precondition Failed", readResponse(t, br).statusLine)
+	resp := readResponse(t, br)
+	assert.Equal(t, "HTTP/1.1 200 OK", resp.statusLine)
+	assert.Equal(t, "cached page", resp.body)
+}
+
+func TestNegotiate(t *testing.T) {
+	conn := startServer(t, func(w *response.Writer, req *request.Request) {
+		h := response.GetDefaultHeaders(0)
+		h.Override("Vary", "Origin")
+		offer, ok := Negotiate(w, req, h,
+			Offer{ContentType: "text/html", Language: "en"},
+			Offer{ContentType: "application/json", Language: "en"},
+			Offer{ContentType: "text/html", Language: "de"},
+		)
+		if !ok {
+			return
+		}
+		body := []byte(offer.ContentType + " " + offer.Language)
+		h.Override("Content-Length", strconv.Itoa(len(body)))
+		w.WriteStatusLine(200)
+		w.WriteHeaders(h)
+		w.WriteBody(body)
+	})
+	br := bufio.NewReader(conn)
+
+	tests := []struct {
+		fields string
+		body   string
+	}{
+		{fields: "", body: "text/html en"},
+		{fields: "Accept: application/json, text/*;q=0.5\r\n", body: "application/json en"},
+		{fields: "Accept: */*\r\nAccept-Language: de-DE, de;q=0.9, en;q=0.1\r\n", body: "text/html de"},
+		{fields: "Accept: application/*\r\nAccept-Language: de\r\n", body: ""},
+	}
+	for _, tt := range tests {
+		_, err := conn.Write([]byte("GET / HTTP/1.1\r\nHost: localhost\r\n" + tt.fields + "\r\n"))
+		require.NoError(t, err)
+		resp := readResponse(t, br)
+		if tt.body == "" {
+			assert.Equal(t, "HTTP/1.1 406 Not Acceptable", resp.statusLine)
+			assert.Equal(t, "Accept, Accept-Language", resp.headers["vary"])
+			continue
+		}
+		assert.Equal(t, "HTTP/1.1 200 OK", resp.statusLine)
+		assert.Equal(t, tt.body, resp.body)
+		contentType, language, _ := strings.Cut(tt.body, " ")
+		assert.Equal(t, contentType, resp.headers["content-type"])
+		assert.Equal(t, language, resp.headers["content-language"])
+		assert.Equal(t, "Origin, Accept, Accept-Language", resp.headers["vary"])
+		assert.NotContains(t, resp.headers, "content-encoding")
+	}
+}
+
+func TestCloseIdleConnection(t *testing.T) {
+	s, err := Serve(0, echoTarget)
+	require.NoError(t, err)
+	conn, err := net.Dial("tcp", s.listener.Addr().String())
+	require.NoError(t, err)
+	defer conn.Close()
+	br := bufio.NewReader(conn)
+
+	_, err = conn.Write([]byte("GET /a HTTP/1.1\r\nHost: localhost\r\n\r\n"))
+	require.NoError(t, err)
+	assert.Equal(t, "/a", readResponse(t, br).body)
+
+	require.NoError(t, s.Close())
+	conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	_, err = br.ReadByte()
+	assert.ErrorIs(t, err, io.EOF)
+}
+
+func TestIdleTimeout(t *testing.T) {
+	conn := startServer(t, echoTarget, WithIdleTimeout(50*time.Millisecond))
+	br := bufio.NewReader(conn)
+
+	_, err := conn.Write([]byte("GET /a HTTP/1.1\r\nHost: localhost\r\n\r\n"))
+	require.NoError(t, err)
+	assert.Equal(t, "/a", readResponse(t, br).body)
+
+	// a client that stops halfway through its headers is dropped as well
+	_, err = conn.Write([]byte("GET /b HTTP/1.1\r\nHost: loc"))
+	require.NoError(t, err)
+	conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	_, err = br.ReadByte()
+	assert.ErrorIs(t, err, io.EOF)
+}
+
+func TestHeadKeepsConnection(t *testing.T) {
+	conn := startServer(t, echoTarget)
+	br := bufio.NewReader(conn)
+
+	_, err := conn.Write([]byte("HEAD /a HTTP/1.1\r\nHost: localhost\r\n\r\n" +
+		"GET /b HTTP/1.1\r\nHost: localhost\r\n\r\n"))
+	require.NoError(t, err)
+
+	assert.Equal(t, "HTTP/1.1 200 OK", readLine(t, br))
+	fields := map[string]string{}
+	for line := readLine(t, br); line != ""; line = readLine(t, br) {
+		key, value, _ := strings.Cut(line, ": ")
+		fields[key] = value
+	}
+	assert.Equal(t, "2", fields["content-length"])
+	assert.NotContains(t, fields, "connection")
+
+	resp := readResponse(t, br)
+	assert.Equal(t, "HTTP/1.1 200 OK", resp.statusLine)
+	assert.Equal(t, "/b", resp.body)
+}
@@ -0,0 +1,54 @@
+package server
+
+import (
+	"strings"
+
+	"github.com/P-H-Pancholi/httpfromtcp/internal/request"
+	"github.com/P-H-Pancholi/httpfromtcp/internal/response"
+)
+
+// VirtualHosts dispatches requests to a handler chosen by the host they
+// are for, so one Server can serve several names
+type VirtualHosts struct {
+	hosts    map[string]Handler
+	fallback Handler
+}
+
+// NewVirtualHosts returns a dispatcher that hands requests for hosts that
+// weren't added to fallback. A nil fallback answers them with 404 Not
+// Found.
+func NewVirtualHosts(fallback Handler) *VirtualHosts {
+	return &VirtualHosts{
+		hosts:    map[string]Handler{},
+		fallback: fallback,
+	}
+}
+
+// Add routes requests for host to handler. A host with a port only matches
+// requests for that port, one without matches any port. Hosts are
+// compared case-insensitively.
+func (v *VirtualHosts) Add(host string, handler Handler) {
+	v.hosts[strings.TrimSuffix(strings.ToLower(host), ".")] = handler
+}
+
+// Handle is the Handler to pass to Serve
+func (v *VirtualHosts) Handle(w *response.Writer, req *request.Request) {
+	if req.Port != "" {
+		if h, ok := v.hosts[req.Host+":"+req.Port]; ok {
+			h(w, req)
+			return
+		}
+	}
+	if h, ok := v.hosts[req.Host]; ok {
+		h(w, req)
+		return
+	}
+	if v.fallback != nil {
+		v.fallback(w, req)
+		return
+	}
+	body := []byte("Not Found")
+	w.WriteStatusLine(404)
+	w.WriteHeaders(response.GetDefaultHeaders(len(body)))
+	w.WriteBody(body)
+}